@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	dsmrprometheus "github.com/basvdlei/gotsmart/dsmr/prometheus"
+)
+
+// frameJSON is the representation of a frame served on /api/v1/frame.
+type frameJSON struct {
+	Header      string       `json:"header"`
+	Version     string       `json:"version,omitempty"`
+	EquipmentID string       `json:"equipment_id,omitempty"`
+	Timestamp   *time.Time   `json:"timestamp,omitempty"`
+	Received    time.Time    `json:"received"`
+	CRC         string       `json:"crc"`
+	Objects     []objectJSON `json:"objects"`
+	Errors      []string     `json:"errors,omitempty"`
+}
+
+// objectJSON is an object of a frame. Value is set for numeric objects and
+// Text for all others.
+type objectJSON struct {
+	ID     string      `json:"id"`
+	Name   string      `json:"name,omitempty"`
+	Metric string      `json:"metric,omitempty"`
+	Value  *float64    `json:"value,omitempty"`
+	Text   string      `json:"text,omitempty"`
+	Unit   string      `json:"unit,omitempty"`
+	Values []valueJSON `json:"values,omitempty"`
+}
+
+type valueJSON struct {
+	Value string `json:"value"`
+	Unit  string `json:"unit,omitempty"`
+}
+
+// newFrameJSON returns the representation of a frame received at t. The
+// errors are the lines of the frame that could not be parsed.
+func newFrameJSON(f dsmr.Frame, raw []byte, t time.Time, errs []dsmr.LineError) frameJSON {
+	fj := frameJSON{
+		Header:      f.Header,
+		Version:     f.Version,
+		EquipmentID: f.EquipmentID,
+		Received:    t,
+		CRC:         "valid",
+		Objects:     []objectJSON{},
+	}
+	if !f.Timestamp.IsZero() {
+		fj.Timestamp = &f.Timestamp
+	}
+	// Frames of DSMR 2.2 and 3.0 meters have no CRC.
+	if i := bytes.LastIndexByte(raw, '!'); i >= 0 && len(bytes.TrimSpace(raw[i+1:])) == 0 {
+		fj.CRC = "missing"
+	}
+	for _, obj := range f.SortedObjects() {
+		o := objectJSON{ID: obj.ID, Unit: obj.Unit, Text: obj.Value}
+		mb, found := dsmrprometheus.Lookup(f, obj.ID)
+		if found {
+			o.Name, o.Metric = mb.Help, mb.Name
+		} else {
+			o.Name = dsmr.Describe(obj.ID)
+		}
+		// Identifiers and timestamps look like numbers too, only readings
+		// with a metric or unit are numeric.
+		if found || obj.Unit != "" {
+			if v, err := strconv.ParseFloat(obj.Value, 64); err == nil {
+				o.Value, o.Text = &v, ""
+			}
+		}
+		switch obj.ID {
+		case "0-0:96.13.0":
+			o.Text = f.TextMessage
+		case "0-0:96.13.1":
+			o.Text = f.TextMessageCode
+		}
+		if len(obj.Values) > 1 {
+			for _, v := range obj.Values {
+				o.Values = append(o.Values, valueJSON{Value: v.Value, Unit: v.Unit})
+			}
+		}
+		fj.Objects = append(fj.Objects, o)
+	}
+	for _, le := range errs {
+		fj.Errors = append(fj.Errors, le.Error())
+	}
+	return fj
+}
+
+// frameapi keeps the last frame as JSON.
+type frameapi struct {
+	mutex sync.Mutex
+	body  []byte
+	etag  string
+	time  time.Time
+}
+
+func (a *frameapi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	body, etag, t := a.body, a.etag, a.time
+	a.mutex.Unlock()
+	if body == nil {
+		http.Error(w, "no frame received yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", t, bytes.NewReader(body))
+}
+
+// Update sets the last frame and returns its JSON representation.
+func (a *frameapi) Update(f dsmr.Frame, raw []byte, errs []dsmr.LineError) []byte {
+	now := time.Now()
+	body, err := json.Marshal(newFrameJSON(f, raw, now, errs))
+	if err != nil {
+		log.Printf("could not encode frame: %v\n", err)
+		return nil
+	}
+	sum := sha1.Sum(body)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.body = append(body, '\n')
+	a.etag = fmt.Sprintf("%q", fmt.Sprintf("%x", sum[:8]))
+	a.time = now
+	return body
+}
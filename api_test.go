@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+const apiFrame = "/ISk5\\2MT382-1000\r\n\r\n" +
+	"1-3:0.2.8(50)\r\n" +
+	"0-0:1.0.0(261016120000S)\r\n" +
+	"0-0:96.1.1(4B384547303034303436333935353037)\r\n" +
+	"1-0:1.8.1(000123.456*kWh)\r\n" +
+	"1-0:1.7.0(01.193*kW)\r\n" +
+	"0-1:24.1.0(003)\r\n" +
+	"0-1:96.1.0(3232323241424344313233343536373839)\r\n" +
+	"0-1:24.2.1(261016115500S)(00012.345*m3)\r\n" +
+	"!A19D\r\n"
+
+// apiFrameDSMR3 is a frame of a DSMR 3 meter, which has no version object and
+// no CRC.
+const apiFrameDSMR3 = "/ISk5\\2MT382-1004\r\n\r\n" +
+	"0-0:96.1.1(4B384547303034303436333935353037)\r\n" +
+	"1-0:1.8.1(00123.456*kWh)\r\n" +
+	"1-0:1.7.0(0001.19*kW)\r\n" +
+	"!\r\n"
+
+// readAPIFrame returns the frame and raw bytes of telegram as read from a
+// meter.
+func readAPIFrame(t *testing.T, telegram string) (dsmr.Frame, []byte) {
+	t.Helper()
+	f, raw, err := dsmr.NewReader(strings.NewReader(telegram)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, raw
+}
+
+// getFrame returns the frame served by a.
+func getFrame(t *testing.T, a *frameapi) frameJSON {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/frame", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status does not match %d", rec.Code)
+	}
+	var fj frameJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &fj); err != nil {
+		t.Fatal(err)
+	}
+	return fj
+}
+
+func TestFrameAPI(t *testing.T) {
+	a := &frameapi{}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/frame", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status without frame does not match %d", rec.Code)
+	}
+
+	f, raw := readAPIFrame(t, apiFrame)
+	if a.Update(f, raw, nil) == nil {
+		t.Fatal("could not update frame")
+	}
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/frame", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status does not match %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type does not match %q", ct)
+	}
+	var fj frameJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &fj); err != nil {
+		t.Fatal(err)
+	}
+	if fj.Version != "50" || fj.EquipmentID != "4B384547303034303436333935353037" || fj.Timestamp == nil || fj.CRC != "valid" {
+		t.Errorf("frame does not match %+v", fj)
+	}
+	objects := make(map[string]objectJSON)
+	for _, o := range fj.Objects {
+		objects[o.ID] = o
+	}
+	if o := objects["1-0:1.8.1"]; o.Metric != "gotsmart_electricity_delivered_to_client_tariff_1_kwh" ||
+		o.Value == nil || *o.Value != 123.456 || o.Unit != "kWh" || o.Text != "" {
+		t.Errorf("reading does not match %+v", o)
+	}
+	// Identifiers look like numbers but are text.
+	if o := objects["0-0:96.1.1"]; o.Value != nil || o.Text != "4B384547303034303436333935353037" {
+		t.Errorf("equipment identifier does not match %+v", o)
+	}
+	if o := objects["0-1:24.2.1"]; o.Metric != "gotsmart_gas_m3" || len(o.Values) != 2 {
+		t.Errorf("gas reading does not match %+v", o)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Fatalf("missing cache headers %v", rec.Header())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/frame", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional status does not match %d != %d", rec.Code, http.StatusNotModified)
+	}
+}
+
+func TestFrameAPIMissingCRC(t *testing.T) {
+	a := &frameapi{}
+	f, raw := readAPIFrame(t, apiFrameDSMR3)
+	if a.Update(f, raw, nil) == nil {
+		t.Fatal("could not update frame")
+	}
+	fj := getFrame(t, a)
+	if fj.Version != "" || fj.EquipmentID != "4B384547303034303436333935353037" || fj.CRC != "missing" {
+		t.Errorf("frame does not match %+v", fj)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+// decodedFrame is the result of decoding a single telegram.
+type decodedFrame struct {
+	Source  string          `json:"source"`
+	Header  string          `json:"header,omitempty"`
+	Objects []decodedObject `json:"objects,omitempty"`
+	Errors  []string        `json:"errors,omitempty"`
+}
+
+type decodedObject struct {
+	ID          string         `json:"id"`
+	Description string         `json:"description,omitempty"`
+	Value       string         `json:"value"`
+	Unit        string         `json:"unit,omitempty"`
+	Values      []decodedValue `json:"values,omitempty"`
+}
+
+type decodedValue struct {
+	Value string `json:"value"`
+	Unit  string `json:"unit,omitempty"`
+}
+
+// decode runs the decode command which prints the objects of the telegrams
+// read from files or stdin. It exits with status 1 when any of the telegrams
+// has an invalid CRC or could not be parsed.
+func decode(args []string) {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	var (
+		formatFlag   = fs.String("format", "table", "Output format (table/json).")
+		tzFlag       = fs.String("timezone", "Europe/Amsterdam", "Time zone of the meter.")
+		protocolFlag = fs.String("protocol", "auto", "DSMR protocol (auto/dsmr4/dsmr3), dsmr3 accepts frames without CRC.")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s decode [flags] [file...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *formatFlag != "table" && *formatFlag != "json" {
+		log.Fatalf("Invalid format %q", *formatFlag)
+	}
+	protocol, err := dsmr.ParseProtocol(*protocolFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	parser := dsmr.Parser{Strict: true}
+	if parser.Location, err = time.LoadLocation(*tzFlag); err != nil {
+		log.Fatalf("Invalid timezone: %v", err)
+	}
+
+	var frames []decodedFrame
+	if fs.NArg() == 0 {
+		frames = decodeTelegrams("stdin", os.Stdin, protocol, parser)
+	}
+	for _, name := range fs.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		frames = append(frames, decodeTelegrams(name, file, protocol, parser)...)
+		file.Close()
+	}
+
+	writeFrames(os.Stdout, *formatFlag, frames)
+	if status := decodeStatus(frames); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// decodeStatus returns the exit status for the decoded frames, 1 when any of
+// them has errors.
+func decodeStatus(frames []decodedFrame) int {
+	for _, f := range frames {
+		if len(f.Errors) > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// writeFrames writes the frames to w in the given format (table/json).
+func writeFrames(w io.Writer, format string, frames []decodedFrame) {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(frames)
+	} else {
+		printFrames(w, frames)
+	}
+}
+
+// decodeTelegrams returns all telegrams read from r.
+func decodeTelegrams(name string, r io.Reader, protocol dsmr.Protocol, parser dsmr.Parser) []decodedFrame {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return []decodedFrame{{Source: name, Errors: []string{err.Error()}}}
+	}
+	// Pasted telegrams usually lost their CRs, which are part of the CRC.
+	if !bytes.Contains(b, []byte("\r\n")) {
+		b = bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+	}
+	// The CRC of the last telegram is only complete at the end of its line.
+	if len(b) > 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		b = append(b, "\r\n"...)
+	}
+	dr := dsmr.NewReader(bytes.NewReader(b))
+	dr.Protocol = protocol
+	dr.Parser = parser
+
+	var frames []decodedFrame
+	for {
+		frame, _, err := dr.Next()
+		if err == io.EOF {
+			break
+		}
+		d := decodedFrame{Source: fmt.Sprintf("%s #%d", name, len(frames)+1)}
+		var crcErr *dsmr.ChecksumError
+		var parseErr *dsmr.ParseError
+		switch {
+		case err == nil:
+		case errors.As(err, &parseErr):
+			for _, le := range parseErr.Errors {
+				d.Errors = append(d.Errors, le.Error())
+			}
+		case errors.As(err, &crcErr), err == dsmr.ErrMissingChecksum,
+			err == dsmr.ErrFrameTooLarge:
+			d.Errors = append(d.Errors, err.Error())
+			frames = append(frames, d)
+			continue
+		default:
+			d.Errors = append(d.Errors, err.Error())
+			return append(frames, d)
+		}
+		d.Header = frame.Header
+		for _, obj := range frame.SortedObjects() {
+			o := decodedObject{
+				ID:          obj.ID,
+				Description: dsmr.Describe(obj.ID),
+				Value:       obj.Value,
+				Unit:        obj.Unit,
+			}
+			switch obj.ID {
+			case "0-0:96.13.0":
+				o.Value = frame.TextMessage
+			case "0-0:96.13.1":
+				o.Value = frame.TextMessageCode
+			}
+			if len(obj.Values) > 1 {
+				for _, v := range obj.Values {
+					o.Values = append(o.Values, decodedValue{Value: v.Value, Unit: v.Unit})
+				}
+			}
+			d.Objects = append(d.Objects, o)
+		}
+		frames = append(frames, d)
+	}
+	if len(frames) == 0 {
+		frames = append(frames, decodedFrame{Source: name, Errors: []string{"no telegram found"}})
+	}
+	return frames
+}
+
+// printFrames prints the frames as tables.
+func printFrames(w io.Writer, frames []decodedFrame) {
+	for i, f := range frames {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, strings.TrimSpace(f.Source+": "+f.Header))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, o := range f.Objects {
+			value, unit := o.Value, o.Unit
+			if len(o.Values) > 0 {
+				values := make([]string, len(o.Values))
+				for i, v := range o.Values {
+					values[i] = "(" + dsmr.ObjectValue{Value: v.Value, Unit: v.Unit}.String() + ")"
+				}
+				value, unit = strings.Join(values, ""), ""
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.ID, o.Description, value, unit)
+		}
+		tw.Flush()
+		for _, err := range f.Errors {
+			fmt.Fprintf(w, "Error: %s\n", err)
+		}
+	}
+}
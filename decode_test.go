@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/basvdlei/gotsmart/dsmr/simulator"
+)
+
+func TestDecodeTelegrams(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := simulator.New(simulator.Config{Location: time.UTC}, start)
+	telegram := string(m.Telegram(start))
+	bad := []byte(telegram)
+	// Corrupt the last digit of the CRC.
+	if i := len(bad) - 3; bad[i] == '0' {
+		bad[i] = '1'
+	} else {
+		bad[i] = '0'
+	}
+	lf := strings.ReplaceAll(telegram, "\r\n", "\n")
+
+	tests := map[string]struct {
+		input  string
+		errors []int
+		status int
+	}{
+		"crlf":                   {telegram, []int{0}, 0},
+		"lf":                     {lf, []int{0}, 0},
+		"missing newline":        {strings.TrimSuffix(telegram, "\r\n"), []int{0}, 0},
+		"lf missing newline":     {strings.TrimSuffix(lf, "\n"), []int{0}, 0},
+		"bad crc":                {string(bad), []int{1}, 1},
+		"bad crc before good":    {string(bad) + telegram, []int{1, 0}, 1},
+		"second missing newline": {lf + strings.TrimSuffix(lf, "\n"), []int{0, 0}, 0},
+		"no telegram":            {"garbage", []int{1}, 1},
+	}
+	parser := dsmr.Parser{Location: time.UTC, Strict: true}
+	for name, tc := range tests {
+		frames := decodeTelegrams("test", strings.NewReader(tc.input), dsmr.ProtocolAuto, parser)
+		if len(frames) != len(tc.errors) {
+			t.Errorf("%s: frames do not match %d != %d: %+v", name, len(frames), len(tc.errors), frames)
+			continue
+		}
+		for i, f := range frames {
+			if len(f.Errors) != tc.errors[i] {
+				t.Errorf("%s: errors of frame %d do not match %q", name, i, f.Errors)
+			}
+			if len(f.Errors) == 0 && (f.Header != "/XMX5LGF0000454324731" || len(f.Objects) == 0) {
+				t.Errorf("%s: frame %d does not match %+v", name, i, f)
+			}
+		}
+		if got := decodeStatus(frames); got != tc.status {
+			t.Errorf("%s: exit status does not match %d != %d", name, got, tc.status)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := simulator.New(simulator.Config{Location: time.UTC}, start)
+	parser := dsmr.Parser{Location: time.UTC, Strict: true}
+	frames := decodeTelegrams("test", bytes.NewReader(m.Telegram(start)), dsmr.ProtocolAuto, parser)
+
+	var buf bytes.Buffer
+	writeFrames(&buf, "json", frames)
+	var got []decodedFrame
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Source != "test #1" || got[0].Header != "/XMX5LGF0000454324731" || len(got[0].Errors) != 0 {
+		t.Fatalf("frames do not match %+v", got)
+	}
+	objects := make(map[string]decodedObject)
+	for _, o := range got[0].Objects {
+		objects[o.ID] = o
+	}
+	if o := objects["1-0:1.8.1"]; o.Value != "005725.981" || o.Unit != "kWh" || o.Description == "" {
+		t.Errorf("reading does not match %+v", o)
+	}
+}
@@ -0,0 +1,163 @@
+package dsmr
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// generalGloCiphering is the DLMS tag that starts an encrypted telegram.
+	generalGloCiphering = 0xDB
+	// gcmTagSize is the size of the authentication tag used by DLMS.
+	gcmTagSize = 12
+	// systemTitleSize is the size of the system title of a meter.
+	systemTitleSize = 8
+)
+
+// ErrDecryption is returned when an encrypted telegram could not be
+// decrypted, usually because of a wrong key or additional authenticated data.
+var ErrDecryption = errors.New("dsmr: could not decrypt telegram")
+
+// Decrypter decrypts DSMR telegrams that are wrapped in a DLMS
+// general-glo-ciphering frame encrypted with AES-128-GCM, as sent by
+// Luxembourg (Smarty) and some Austrian meters.
+//
+// An encrypted telegram is formatted as:
+//
+//	DB len systitle length SC FC ciphertext tag
+type Decrypter struct {
+	aead cipher.AEAD
+	aad  []byte
+}
+
+// NewDecrypter returns a Decrypter for the 16 byte key of a meter. The
+// additional authenticated data, like the security control byte followed by
+// the authentication key, may be nil.
+func NewDecrypter(key, aad []byte) (*Decrypter, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("dsmr: key must be 16 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCMWithTagSize(block, gcmTagSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Decrypter{aead: aead, aad: aad}, nil
+}
+
+// Reader returns a reader that yields the plaintext telegrams of the
+// encrypted telegrams read from r. Telegrams that fail to decrypt are
+// dropped and reported with ErrDecryption, after which reading can continue.
+func (d *Decrypter) Reader(r io.Reader) io.Reader {
+	return &decryptReader{d: d, br: bufio.NewReader(r)}
+}
+
+// Decrypt returns the plaintext of a single telegram given the system title
+// of the meter, the frame counter and the ciphertext including the tag.
+func (d *Decrypter) Decrypt(systemTitle []byte, frameCounter []byte, ciphertext []byte) ([]byte, error) {
+	nonce := make([]byte, 0, d.aead.NonceSize())
+	nonce = append(nonce, systemTitle...)
+	nonce = append(nonce, frameCounter...)
+	if len(nonce) != d.aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+	plaintext, err := d.aead.Open(nil, nonce, ciphertext, d.aad)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+type decryptReader struct {
+	d   *Decrypter
+	br  *bufio.Reader
+	buf []byte
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		plaintext, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = plaintext
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next envelope from the input.
+func (r *decryptReader) next() ([]byte, error) {
+	// Skip everything up to the start of an envelope.
+	for {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == generalGloCiphering {
+			break
+		}
+	}
+	n, err := r.br.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if n != systemTitleSize {
+		return nil, ErrDecryption
+	}
+	systemTitle := make([]byte, n)
+	if _, err := io.ReadFull(r.br, systemTitle); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length, err := r.readLength()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// Security control byte, 4 byte frame counter and at least a tag.
+	if length < 5+gcmTagSize || length > DefaultMaxFrameSize {
+		return nil, ErrDecryption
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r.br, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return r.d.Decrypt(systemTitle, payload[1:5], payload[5:])
+}
+
+// readLength reads a BER encoded length.
+func (r *decryptReader) readLength() (int, error) {
+	b, err := r.br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return int(b), nil
+	}
+	if b&0x7F > 4 {
+		return 0, ErrDecryption
+	}
+	var length int
+	for i := 0; i < int(b&0x7F); i++ {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package dsmr
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+)
+
+var (
+	testKey, _ = hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	testAAD, _ = hex.DecodeString("3000112233445566778899AABBCCDDEEFF")
+)
+
+// encrypt wraps plaintext in a general-glo-ciphering envelope.
+func encrypt(t *testing.T, plaintext []byte, frameCounter byte) []byte {
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCMWithTagSize(block, gcmTagSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemTitle := []byte("SAG12345")
+	fc := []byte{0, 0, 0, frameCounter}
+	nonce := append(append([]byte{}, systemTitle...), fc...)
+	ciphertext := aead.Seal(nil, nonce, plaintext, testAAD)
+
+	length := 5 + len(ciphertext)
+	envelope := []byte{generalGloCiphering, systemTitleSize}
+	envelope = append(envelope, systemTitle...)
+	envelope = append(envelope, 0x82, byte(length>>8), byte(length))
+	envelope = append(envelope, 0x30)
+	envelope = append(envelope, fc...)
+	return append(envelope, ciphertext...)
+}
+
+func TestDecrypter(t *testing.T) {
+	d, err := NewDecrypter(testKey, testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input bytes.Buffer
+	input.WriteString("\x00garbage")
+	input.Write(encrypt(t, []byte(telegram(frame)), 1))
+	input.Write(encrypt(t, []byte(telegram(frame)), 2))
+
+	r := NewReader(d.Reader(&input))
+	for i := 0; i < 2; i++ {
+		f, _, err := r.Next()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if len(f.Objects) != len(frameWant) {
+			t.Errorf("frame %d: size does not match %d != %d", i, len(f.Objects), len(frameWant))
+		}
+	}
+}
+
+func TestDecrypterWrongKey(t *testing.T) {
+	key := append([]byte{}, testKey...)
+	key[0] ^= 0xFF
+	d, err := NewDecrypter(key, testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(d.Reader(bytes.NewReader(encrypt(t, []byte(telegram(frame)), 1))))
+	if _, _, err := r.Next(); err != ErrDecryption {
+		t.Errorf("expected decryption error, got %v", err)
+	}
+}
+
+func TestNewDecrypterKeySize(t *testing.T) {
+	if _, err := NewDecrypter([]byte("short"), nil); err == nil {
+		t.Error("expected error for short key")
+	}
+}
@@ -0,0 +1,80 @@
+package dsmr
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Demand is a peak of the quarter-hourly average power demand as registered
+// by Belgian (e-MUCS) meters for the capacity tariff.
+type Demand struct {
+	// Month is the start of the month of the peak, only set in the
+	// history.
+	Month time.Time
+	// Time is when the peak occurred.
+	Time  time.Time
+	Value float64
+	Unit  string
+}
+
+// noDemandTimestamp is sent instead of the time of the peak when no peak was
+// registered, e.g. at the start of the month or for months before the meter
+// was installed.
+const noDemandTimestamp = "632525252525W"
+
+// parseDemand parses the values of the maximum demand of the running month
+// 1-0:1.6.0(timestamp)(value*unit). The Time is zero when no peak was
+// registered.
+func parseDemand(values []ObjectValue, loc *time.Location) (d Demand, err error) {
+	if len(values) != 2 {
+		return d, fmt.Errorf("expected 2 values, got %d", len(values))
+	}
+	if values[0].Value != noDemandTimestamp {
+		if d.Time, err = parseTimestamp(values[0].Value, loc); err != nil {
+			return d, err
+		}
+	}
+	d.Value, err = values[1].Float()
+	d.Unit = values[1].Unit
+	return d, err
+}
+
+// parseDemandHistory parses the buffer of monthly peaks 0-0:98.1.0 which is
+// formatted as:
+//
+//	(count)(OBIS)(OBIS)(end of month)(timestamp)(value*unit)...
+//
+// Months without a registered peak are skipped.
+func parseDemandHistory(values []ObjectValue, loc *time.Location) ([]Demand, error) {
+	if len(values) < 3 {
+		return nil, fmt.Errorf("expected at least 3 values, got %d", len(values))
+	}
+	n, err := strconv.Atoi(values[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	entries := values[3:]
+	if len(entries) != n*3 {
+		return nil, fmt.Errorf("expected %d entries, got %d values", n, len(entries))
+	}
+	history := make([]Demand, 0, n)
+	for i := 0; i < len(entries); i += 3 {
+		if entries[i+1].Value == noDemandTimestamp {
+			continue
+		}
+		// The entry is stamped with the end of the month, which is the
+		// start of the next month.
+		end, err := parseTimestamp(entries[i].Value, loc)
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseDemand(entries[i+1:i+3], loc)
+		if err != nil {
+			return nil, err
+		}
+		d.Month = end.AddDate(0, -1, 0)
+		history = append(history, d)
+	}
+	return history, nil
+}
@@ -0,0 +1,124 @@
+package dsmr
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basvdlei/gotsmart/crc16"
+)
+
+// specOrder lists the objects in the order of the DSMR specification, with
+// the Belgian e-MUCS objects in between.
+var specOrder = []string{
+	"0-0:96.1.4", "1-3:0.2.8", "0-0:1.0.0", "0-0:96.1.1",
+	"1-0:1.8.1", "1-0:1.8.2", "1-0:2.8.1", "1-0:2.8.2", "0-0:96.14.0",
+	"1-0:1.4.0", "1-0:1.6.0", "0-0:98.1.0",
+	"1-0:1.7.0", "1-0:2.7.0", "0-0:17.0.0", "0-0:96.3.10",
+	"0-0:96.7.21", "0-0:96.7.9", "1-0:99.97.0",
+	"1-0:32.32.0", "1-0:52.32.0", "1-0:72.32.0",
+	"1-0:32.36.0", "1-0:52.36.0", "1-0:72.36.0",
+	"0-0:96.13.1", "0-0:96.13.0",
+	"1-0:32.7.0", "1-0:52.7.0", "1-0:72.7.0",
+	"1-0:31.7.0", "1-0:51.7.0", "1-0:71.7.0",
+	"1-0:21.7.0", "1-0:41.7.0", "1-0:61.7.0",
+	"1-0:22.7.0", "1-0:42.7.0", "1-0:62.7.0",
+}
+
+// mbusOrder lists the objects of an M-Bus device in specification order.
+var mbusOrder = []string{"24.1.0", "96.1.0", "24.2.1", "24.2.3", "24.3.0", "24.4.0"}
+
+// mbusIDRegexp matches any M-Bus object with 2 groups:
+//   - Channel eg `1`
+//   - Object eg `24.2.1`
+var mbusIDRegexp = regexp.MustCompile("^0-([1-9][0-9]*):(.*)$")
+
+// objectKey returns a key to sort objects in specification order. Known
+// objects come first, then M-Bus objects by channel and last all others.
+func objectKey(id string) (group, channel, index int) {
+	for i, known := range specOrder {
+		if id == known {
+			return 0, 0, i
+		}
+	}
+	if m := mbusIDRegexp.FindStringSubmatch(id); m != nil {
+		channel, _ = strconv.Atoi(m[1])
+		for i, known := range mbusOrder {
+			if m[2] == known {
+				return 1, channel, i
+			}
+		}
+		return 1, channel, len(mbusOrder)
+	}
+	return 2, 0, 0
+}
+
+// SortedObjects returns the objects of the frame in specification order,
+// including the version, timestamp and equipment identifier which are only
+// kept as fields of the frame. The timestamp is formatted in the location of
+// the meter.
+func (f Frame) SortedObjects() []DataObject {
+	objects := make([]DataObject, 0, len(f.Objects)+3)
+	// Belgian meters only send their version as 0-0:96.1.4, which is kept
+	// as object.
+	if belgian, found := f.Objects["0-0:96.1.4"]; f.Version != "" && (!found || belgian.Value != f.Version) {
+		objects = append(objects, DataObject{ID: "1-3:0.2.8", Value: f.Version})
+	}
+	if !f.Timestamp.IsZero() {
+		t := f.Timestamp
+		if loc, err := (Parser{Location: f.Location}).location(); err == nil {
+			t = t.In(loc)
+		}
+		flag := "W"
+		if t.IsDST() {
+			flag = "S"
+		}
+		objects = append(objects, DataObject{
+			ID:    "0-0:1.0.0",
+			Value: t.Format(DateTimeFormat) + flag,
+		})
+	}
+	if f.EquipmentID != "" {
+		objects = append(objects, DataObject{ID: "0-0:96.1.1", Value: f.EquipmentID})
+	}
+	for _, obj := range f.Objects {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		gi, ci, ii := objectKey(objects[i].ID)
+		gj, cj, ij := objectKey(objects[j].ID)
+		if gi != gj {
+			return gi < gj
+		}
+		if ci != cj {
+			return ci < cj
+		}
+		if ii != ij {
+			return ii < ij
+		}
+		return objects[i].ID < objects[j].ID
+	})
+	return objects
+}
+
+// Encode returns the telegram of the frame including the CRC, so that
+// ParseFrame(Encode(f)) results in the same frame. The frame timestamp is
+// formatted in the location of the meter.
+func Encode(f Frame) ([]byte, error) {
+	if !strings.HasPrefix(f.Header, "/") {
+		return nil, fmt.Errorf("dsmr: header must start with '/': %q", f.Header)
+	}
+	objects := f.SortedObjects()
+
+	var buf bytes.Buffer
+	buf.WriteString(f.Header + "\r\n\r\n")
+	for _, obj := range objects {
+		buf.WriteString(obj.String() + "\r\n")
+	}
+	buf.WriteByte('!')
+	fmt.Fprintf(&buf, "%04X\r\n", crc16.Checksum(buf.Bytes()))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,127 @@
+package dsmr
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	frames := map[string]string{
+		"dsmr4": frame,
+		"belgian": "/FLU5\\253769484_A\r\n\r\n" +
+			"0-0:96.1.4(50217)\r\n" +
+			"0-0:96.1.1(3153414123456789012345678901234567)\r\n" +
+			"0-0:1.0.0(211031023000W)\r\n" +
+			"1-0:1.6.0(200509134558S)(02.589*kW)\r\n" +
+			"0-0:98.1.0(1)(1-0:1.6.0)(1-0:1.6.0)(200501000000S)(200423192538S)(03.695*kW)\r\n" +
+			"0-1:24.1.0(003)\r\n" +
+			"0-1:24.2.3(200512134558S)(00112.384*m3)\r\n" +
+			"!\r\n",
+		"legacy": "/ISk5\\2ME382-1003\r\n\r\n" +
+			"0-0:96.1.1(4B413650303035303731343131343936)\r\n" +
+			"0-1:24.3.0(121030140000)(00)(60)(1)(0-1:24.2.1)(m3)\r\n" +
+			"(00501.239)\r\n" +
+			"!\r\n",
+	}
+	for name, input := range frames {
+		t.Run(name, func(t *testing.T) {
+			want, err := ParseFrame(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Encode(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := NewReader(strings.NewReader(string(b))).Next()
+			if err != nil {
+				t.Fatalf("could not read encoded frame: %v\n%s", err, b)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("frame does not match\n%+v\n!=\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEncodeOrder(t *testing.T) {
+	f := Frame{
+		Header:  "/XMX5LGBBFG1009421637",
+		Version: "50",
+		Objects: map[string]DataObject{
+			"0-2:24.2.1":  {ID: "0-2:24.2.1", Value: "00001.000", Unit: "m3"},
+			"0-1:24.1.0":  {ID: "0-1:24.1.0", Value: "003"},
+			"1-0:1.7.0":   {ID: "1-0:1.7.0", Value: "00.372", Unit: "kW"},
+			"1-0:1.8.1":   {ID: "1-0:1.8.1", Value: "000093.179", Unit: "kWh"},
+			"9-9:99.99.9": {ID: "9-9:99.99.9", Value: "1"},
+		},
+	}
+	b, err := Encode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "/XMX5LGBBFG1009421637\r\n\r\n" +
+		"1-3:0.2.8(50)\r\n" +
+		"1-0:1.8.1(000093.179*kWh)\r\n" +
+		"1-0:1.7.0(00.372*kW)\r\n" +
+		"0-1:24.1.0(003)\r\n" +
+		"0-2:24.2.1(00001.000*m3)\r\n" +
+		"9-9:99.99.9(1)\r\n" +
+		"!"
+	if !strings.HasPrefix(string(b), want) {
+		t.Errorf("telegram does not match\n%s", b)
+	}
+
+	if _, err := Encode(Frame{}); err == nil {
+		t.Error("expected error for missing header")
+	}
+	// Frames are not marshaled as telegrams.
+	if _, err := json.Marshal(Frame{}); err != nil {
+		t.Errorf("could not marshal frame: %v", err)
+	}
+}
+
+func TestEncodeBelgianVersion(t *testing.T) {
+	f, err := ParseFrame("/FLU5\\253769484_A\r\n\r\n" +
+		"0-0:96.1.4(50217)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Encode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "0-0:96.1.4(50217)\r\n") || strings.Contains(string(b), "1-3:0.2.8") {
+		t.Errorf("version does not match\n%s", b)
+	}
+}
+
+func TestEncodeTimestampLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := Frame{
+		Header:    "/XMX5LGBBFG1009421637",
+		Timestamp: time.Date(2016, 10, 1, 11, 53, 4, 0, time.UTC),
+		Location:  loc,
+	}
+	b, err := Encode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "0-0:1.0.0(161001135304S)\r\n") {
+		t.Errorf("timestamp does not match\n%s", b)
+	}
+	got, _, err := NewReader(strings.NewReader(string(b))).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Timestamp.Equal(f.Timestamp) {
+		t.Errorf("timestamp does not match %v != %v", got.Timestamp, f.Timestamp)
+	}
+}
@@ -0,0 +1,57 @@
+package dsmr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reasons why a line of a frame could not be parsed.
+const (
+	ReasonNoObject         = "no_object"
+	ReasonInvalidTimestamp = "invalid_timestamp"
+	ReasonInvalidValue     = "invalid_value"
+)
+
+// errInvalidTimestamp is wrapped by all timestamp parse errors.
+var errInvalidTimestamp = errors.New("invalid timestamp")
+
+// LineError describes a line of a frame that could not be parsed.
+type LineError struct {
+	// Line is the line number within the frame, starting at 1.
+	Line   int
+	Text   string
+	Reason string
+	Err    error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d %q: %s: %v", e.Line, e.Text, e.Reason, e.Err)
+}
+
+func (e LineError) Unwrap() error {
+	return e.Err
+}
+
+// newLineError returns a LineError with the reason derived from err.
+func newLineError(n int, text string, err error) LineError {
+	reason := ReasonInvalidValue
+	if errors.Is(err, errInvalidTimestamp) {
+		reason = ReasonInvalidTimestamp
+	}
+	return LineError{Line: n, Text: text, Reason: reason, Err: err}
+}
+
+// ParseError is returned by a strict Parser for a frame with lines that
+// could not be parsed.
+type ParseError struct {
+	Errors []LineError
+}
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, le := range e.Errors {
+		msgs[i] = le.Error()
+	}
+	return "dsmr: malformed frame: " + strings.Join(msgs, "; ")
+}
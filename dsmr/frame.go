@@ -13,6 +13,7 @@ package dsmr
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -30,6 +31,8 @@ var (
 	//  - Value eg `000084.276`
 	//  - Unit (optional) eg `kWh`
 	defaultValueRegexp = regexp.MustCompile("([^*]+)\\*?(.*)")
+	// valuesRegexp matches each of the parenthesised values of an object.
+	valuesRegexp = regexp.MustCompile("\\(([^()]*)\\)")
 )
 
 // Frame represents a DSMR4 frame as send from a P1 port.
@@ -38,30 +41,99 @@ type Frame struct {
 	Version     string
 	EquipmentID string
 	Timestamp   time.Time
+	// Location is the time zone of the meter the frame was parsed in. The
+	// zero value means Europe/Amsterdam like for the Parser.
+	Location *time.Location
+
+	// MaximumDemand is the peak demand of the current month and
+	// DemandHistory the peaks of the previous months, as sent by Belgian
+	// meters.
+	MaximumDemand Demand
+	DemandHistory []Demand
+
+	// PowerFailures is the power failure event log.
+	PowerFailures []PowerFailure
+
+	// MBusDevices are the devices connected to the meter by channel.
+	MBusDevices map[int]MBusDevice
+
+	// TextMessage and TextMessageCode are the decoded messages the grid
+	// operator sent to the meter, like outage or maintenance notices.
+	TextMessage     string
+	TextMessageCode string
 
 	Objects map[string]DataObject
 }
 
-// DataObject represents a line in the DSMR frame.
+// DataObject represents a line in the DSMR frame. Value and Unit hold the
+// last value of the object which, for objects with a capture time or other
+// arguments, is the actual reading. All values are kept in Values.
 type DataObject struct {
-	ID    string
+	ID     string
+	Value  string
+	Unit   string
+	Values []ObjectValue
+}
+
+func (do DataObject) String() string {
+	values := do.Values
+	if len(values) == 0 {
+		values = []ObjectValue{{Value: do.Value, Unit: do.Unit}}
+	}
+	var sb strings.Builder
+	sb.WriteString(do.ID)
+	for _, v := range values {
+		sb.WriteString("(" + v.String() + ")")
+	}
+	return sb.String()
+}
+
+// ObjectValue is a single value of a DataObject with an optional unit.
+type ObjectValue struct {
 	Value string
 	Unit  string
 }
 
-func (do DataObject) String() string {
-	if do.Unit == "" {
-		return fmt.Sprintf("%s(%s)", do.ID, do.Value)
+func (v ObjectValue) String() string {
+	if v.Unit == "" {
+		return v.Value
 	}
-	return fmt.Sprintf("%s(%s*%s)", do.ID, do.Value, do.Unit)
+	return v.Value + "*" + v.Unit
+}
+
+// Float returns the value as a number.
+func (v ObjectValue) Float() (float64, error) {
+	return strconv.ParseFloat(v.Value, 64)
+}
+
+// Parser parses frames with options. The zero value is ready to use.
+type Parser struct {
+	// Location is the time zone of the meter, which defaults to
+	// Europe/Amsterdam.
+	Location *time.Location
+	// Strict makes ParseFrame return a *ParseError when any of the lines
+	// could not be parsed. The frame is still returned with all the lines
+	// that could be parsed. By default malformed lines are skipped.
+	Strict bool
 }
 
 // ParseFrame returns a frame from the text respresentation.
 func ParseFrame(frame string) (f Frame, err error) {
+	return Parser{}.ParseFrame(frame)
+}
+
+// ParseFrame returns a frame from the text respresentation.
+func (p Parser) ParseFrame(frame string) (f Frame, err error) {
 	f.Objects = make(map[string]DataObject)
+	loc, err := p.location()
+	if err != nil {
+		return f, err
+	}
+	f.Location = loc
 
-	for _, s := range strings.Split(frame, "\n") {
-		s = strings.TrimSpace(s)
+	var errs []LineError
+	for _, l := range joinLines(frame) {
+		s := l.text
 
 		// skip lines without objects
 		if s == "" || s[0] == '!' {
@@ -73,64 +145,127 @@ func ParseFrame(frame string) (f Frame, err error) {
 
 		obj, err := ParseObject(s)
 		if err != nil {
+			errs = append(errs, LineError{Line: l.n, Text: s, Reason: ReasonNoObject, Err: err})
 			continue
 		}
+		if isLegacyGas(obj.ID) {
+			// DSMR 2.2/3.0: (capture time)(..)(..)(..)(OBIS)(unit)(value)
+			if v := obj.Values; len(v) == 7 {
+				obj.Value = v[6].Value
+				obj.Unit = v[5].Value
+			}
+		}
+
+		if err := f.updateMBus(obj, loc); err != nil {
+			errs = append(errs, newLineError(l.n, s, err))
+		}
 
 		switch obj.ID {
 		// Version of P1 output
 		case "1-3:0.2.8":
 			f.Version = obj.Value
+		// Version of the Belgian e-MUCS specification
+		case "0-0:96.1.4":
+			if f.Version == "" {
+				f.Version = obj.Value
+			}
+			f.Objects[obj.ID] = obj
 		// Date-Time of P1 output
 		case "0-0:1.0.0":
-			if len(obj.Value) > 2 {
-				// Remove S/W from timestamp
-				timestamp := obj.Value[:len(obj.Value)-1]
-				//daylight := obj.Value[len(obj.Value)-1]
-				loc, err := time.LoadLocation("Europe/Amsterdam")
-				if err != nil {
-					continue
-				}
-				t, err := time.ParseInLocation(DateTimeFormat, timestamp, loc)
-				if err != nil {
-					continue
-				}
-				f.Timestamp = t
-			}
+			f.Timestamp, err = parseTimestamp(obj.Value, loc)
 		case "0-0:96.1.1":
 			f.EquipmentID = obj.Value
+		// Maximum demand of the running month
+		case "1-0:1.6.0":
+			var d Demand
+			if d, err = parseDemand(obj.Values, loc); err == nil {
+				f.MaximumDemand = d
+			}
+			f.Objects[obj.ID] = obj
+		// Maximum demand of the last 13 months
+		case "0-0:98.1.0":
+			var h []Demand
+			if h, err = parseDemandHistory(obj.Values, loc); err == nil {
+				f.DemandHistory = h
+			}
+			f.Objects[obj.ID] = obj
+		// Text message max 1024 characters
+		case "0-0:96.13.0":
+			f.TextMessage = decodeText(obj.Value)
+			f.Objects[obj.ID] = obj
+		// Text message codes
+		case "0-0:96.13.1":
+			f.TextMessageCode = decodeText(obj.Value)
+			f.Objects[obj.ID] = obj
+		// Power failure event log
+		case "1-0:99.97.0":
+			var pfs []PowerFailure
+			if pfs, err = parsePowerFailureLog(obj.Values, loc); err == nil {
+				f.PowerFailures = pfs
+			}
+			f.Objects[obj.ID] = obj
 		default:
 			f.Objects[obj.ID] = obj
 		}
+		if err != nil {
+			errs = append(errs, newLineError(l.n, s, err))
+		}
+	}
+	if p.Strict && len(errs) > 0 {
+		return f, &ParseError{Errors: errs}
 	}
 	return f, nil
 }
 
+// line is a line of a frame with its line number.
+type line struct {
+	n    int
+	text string
+}
+
+// joinLines splits a frame into trimmed lines. Lines starting with a value
+// continue the previous line, as used by the DSMR 2.2/3.0 gas reading.
+func joinLines(frame string) []line {
+	var lines []line
+	for i, s := range strings.Split(frame, "\n") {
+		s = strings.TrimSpace(s)
+		if s != "" && s[0] == '(' && len(lines) > 0 {
+			lines[len(lines)-1].text += s
+			continue
+		}
+		lines = append(lines, line{n: i + 1, text: s})
+	}
+	return lines
+}
+
+// isLegacyGas reports if id is the DSMR 2.2/3.0 gas reading 0-n:24.3.0.
+func isLegacyGas(id string) bool {
+	return strings.HasPrefix(id, "0-") && strings.HasSuffix(id, ":24.3.0")
+}
+
 // ParseObject returns a object for a given line in a frame.
 func ParseObject(line string) (DataObject, error) {
-	m := objectRegexp.FindStringSubmatch(strings.TrimSpace(line))
-	if m == nil || len(m) < 3 {
+	line = strings.TrimSpace(line)
+	m := objectRegexp.FindStringSubmatchIndex(line)
+	if m == nil || len(m) < 6 {
 		return DataObject{}, fmt.Errorf("no object found in string")
 	}
 
-	id := m[1]
-	rawValue := m[2]
+	do := DataObject{ID: line[m[2]:m[3]]}
+	for _, v := range valuesRegexp.FindAllStringSubmatch(line[m[3]:], -1) {
+		do.Values = append(do.Values, parseObjectValue(v[1]))
+	}
+	last := do.Values[len(do.Values)-1]
+	do.Value = last.Value
+	do.Unit = last.Unit
+	return do, nil
+}
 
-	m = defaultValueRegexp.FindStringSubmatch(rawValue)
+// parseObjectValue splits a raw value in the value and optional unit.
+func parseObjectValue(rawValue string) ObjectValue {
+	m := defaultValueRegexp.FindStringSubmatch(rawValue)
 	if m == nil {
-		return DataObject{
-			ID:    id,
-			Value: rawValue,
-		}, nil
-	}
-	if len(m) > 2 {
-		return DataObject{
-			ID:    id,
-			Value: m[1],
-			Unit:  m[2],
-		}, nil
+		return ObjectValue{Value: rawValue}
 	}
-	return DataObject{
-		ID:    id,
-		Value: m[1],
-	}, nil
+	return ObjectValue{Value: m[1], Unit: m[2]}
 }
@@ -1,6 +1,9 @@
 package dsmr
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var (
 	frame = `/XMX5LGBBFG1009421637
@@ -153,3 +156,288 @@ func TestParseFrame(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLegacyFrame(t *testing.T) {
+	legacy := "/ISk5\\2ME382-1003\r\n\r\n" +
+		"0-0:96.1.1(4B413650303035303731343131343936)\r\n" +
+		"1-0:1.8.1(00264.129*kWh)\r\n" +
+		"0-1:24.1.0(3)\r\n" +
+		"0-1:24.3.0(121030140000)(00)(60)(1)(0-1:24.2.1)(m3)\r\n" +
+		"(00501.239)\r\n" +
+		"0-1:24.4.0(1)\r\n" +
+		"!\r\n"
+	f, err := ParseFrame(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := f.Objects["0-1:24.3.0"]
+	if !ok {
+		t.Fatal("legacy gas object not found")
+	}
+	if got.Value != "00501.239" || got.Unit != "m3" {
+		t.Errorf("gas reading does not match %s", got)
+	}
+	if len(f.Objects) != 4 {
+		t.Errorf("size does not match %d != %d", len(f.Objects), 4)
+	}
+}
+
+func TestParseBelgianFrame(t *testing.T) {
+	belgian := "/FLU5\\253769484_A\r\n\r\n" +
+		"0-0:96.1.4(50217)\r\n" +
+		"0-0:96.1.1(3153414123456789012345678901234567)\r\n" +
+		"0-0:1.0.0(200512135409S)\r\n" +
+		"1-0:1.4.0(02.351*kW)\r\n" +
+		"1-0:1.6.0(200509134558S)(02.589*kW)\r\n" +
+		"0-0:98.1.0(4)(1-0:1.6.0)(1-0:1.6.0)(200501000000S)(200423192538S)(03.695*kW)" +
+		"(200401000000S)(200305122139S)(05.980*kW)(200301000000S)(200210035421W)(04.318*kW)" +
+		"(200201000000W)(632525252525W)(00.000*kW)\r\n" +
+		"!\r\n"
+	f, err := ParseFrame(belgian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != "50217" {
+		t.Errorf("version does not match %q != %q", f.Version, "50217")
+	}
+	if got := f.Objects["1-0:1.6.0"]; got.Value != "02.589" || got.Unit != "kW" {
+		t.Errorf("maximum demand object does not match %s", got)
+	}
+	want := time.Date(2020, 5, 9, 13, 45, 58, 0, time.FixedZone("CEST", 2*60*60))
+	if !f.MaximumDemand.Time.Equal(want) || f.MaximumDemand.Value != 2.589 {
+		t.Errorf("maximum demand does not match %+v", f.MaximumDemand)
+	}
+	// The month without a peak is skipped.
+	if len(f.DemandHistory) != 3 {
+		t.Fatalf("history size does not match %d != %d", len(f.DemandHistory), 3)
+	}
+	// The entries are stamped with the start of the next month.
+	first, last := f.DemandHistory[0], f.DemandHistory[2]
+	if first.Month.Month() != time.April || first.Month.Day() != 1 {
+		t.Errorf("history month does not match %v", first.Month)
+	}
+	if last.Month.Month() != time.February || last.Value != 4.318 || last.Unit != "kW" {
+		t.Errorf("history entry does not match %+v", last)
+	}
+
+	// At the start of the month no peak is registered yet.
+	f, err = ParseFrame("/FLU5\\253769484_A\r\n\r\n" +
+		"1-0:1.6.0(632525252525W)(00.000*kW)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.MaximumDemand.Time.IsZero() || f.MaximumDemand.Value != 0 || f.MaximumDemand.Unit != "kW" {
+		t.Errorf("maximum demand without peak does not match %+v", f.MaximumDemand)
+	}
+}
+
+func TestParsePowerFailureLog(t *testing.T) {
+	f, err := ParseFrame("/XMX5LGBBFG1009421637\r\n\r\n" +
+		"1-0:99.97.0(2)(0-0:96.7.19)(101208152415W)(0000000240*s)(101208151004W)(0000000301*s)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.PowerFailures) != 2 {
+		t.Fatalf("size does not match %d != %d", len(f.PowerFailures), 2)
+	}
+	want := PowerFailure{
+		End:      time.Date(2010, 12, 8, 15, 10, 4, 0, time.FixedZone("CET", 60*60)),
+		Duration: 301 * time.Second,
+	}
+	got := f.PowerFailures[1]
+	if !got.End.Equal(want.End) || got.Duration != want.Duration {
+		t.Errorf("power failure does not match %+v != %+v", got, want)
+	}
+
+	// An empty log as found in most frames.
+	f, _ = ParseFrame(frame)
+	if len(f.PowerFailures) != 0 {
+		t.Errorf("expected empty power failure log, got %+v", f.PowerFailures)
+	}
+}
+
+func TestParseObjectValues(t *testing.T) {
+	tests := []struct {
+		line string
+		want []ObjectValue
+	}{
+		{
+			line: "1-0:1.8.1(000084.276*kWh)",
+			want: []ObjectValue{{Value: "000084.276", Unit: "kWh"}},
+		},
+		{
+			line: "0-1:24.2.1(101209112500W)(12785.123*m3)",
+			want: []ObjectValue{{Value: "101209112500W"}, {Value: "12785.123", Unit: "m3"}},
+		},
+		{
+			line: "0-1:24.2.3(1234ABC)(00001.234*m3)",
+			want: []ObjectValue{{Value: "1234ABC"}, {Value: "00001.234", Unit: "m3"}},
+		},
+		{
+			line: "0-0:96.13.0()",
+			want: []ObjectValue{{}},
+		},
+	}
+	for _, tt := range tests {
+		d, err := ParseObject(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if len(d.Values) != len(tt.want) {
+			t.Errorf("%s: size does not match %d != %d", tt.line, len(d.Values), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if d.Values[i] != want {
+				t.Errorf("%s: value %d does not match %+v != %+v", tt.line, i, d.Values[i], want)
+			}
+		}
+		last := tt.want[len(tt.want)-1]
+		if d.Value != last.Value || d.Unit != last.Unit {
+			t.Errorf("%s: last value does not match %q*%q", tt.line, d.Value, d.Unit)
+		}
+		if d.String() != tt.line {
+			t.Errorf("string does not match %q != %q", d.String(), tt.line)
+		}
+	}
+}
+
+func TestParseMBusDevices(t *testing.T) {
+	f, err := ParseFrame("/XMX5LGBBFG1009421637\r\n\r\n" +
+		"0-1:24.1.0(003)\r\n" +
+		"0-1:96.1.0(3232323241424344313233343536373839)\r\n" +
+		"0-1:24.2.1(101209112500W)(12785.123*m3)\r\n" +
+		"0-1:24.4.0(1)\r\n" +
+		"0-2:24.1.0(007)\r\n" +
+		"0-2:24.2.1(101209112500W)(00345.678*m3)\r\n" +
+		"0-3:24.1.0(004)\r\n" +
+		"0-3:24.2.1(101209110000W)(01.23*GJ)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]struct {
+		deviceType string
+		value      float64
+		unit       string
+	}{
+		1: {deviceType: "gas", value: 12785.123, unit: "m3"},
+		2: {deviceType: "water", value: 345.678, unit: "m3"},
+		3: {deviceType: "heat", value: 1.23, unit: "GJ"},
+	}
+	if len(f.MBusDevices) != len(want) {
+		t.Errorf("size does not match %d != %d", len(f.MBusDevices), len(want))
+	}
+	for ch, w := range want {
+		d := f.MBusDevices[ch]
+		if d.Channel != ch || d.DeviceTypeName() != w.deviceType ||
+			d.Value != w.value || d.Unit != w.unit || d.CaptureTime.IsZero() {
+			t.Errorf("device on channel %d does not match %+v", ch, d)
+		}
+	}
+	if d := f.MBusDevices[1]; d.EquipmentID != "3232323241424344313233343536373839" || d.ValvePosition != "1" {
+		t.Errorf("gas device does not match %+v", d)
+	}
+	// M-Bus objects remain available as objects.
+	if _, ok := f.Objects["0-1:24.2.1"]; !ok {
+		t.Error("key 0-1:24.2.1 not found")
+	}
+}
+
+func TestParseFrameStrict(t *testing.T) {
+	malformed := "/XMX5LGBBFG1009421637\r\n\r\n" +
+		"1-3:0.2.8(42)\r\n" +
+		"0-0:1.0.0(1610011353S)\r\n" +
+		"garbage\r\n" +
+		"1-0:1.8.1(000093.179*kWh)\r\n" +
+		"0-1:24.2.1(101209112500W)(abc*m3)\r\n" +
+		"!\r\n"
+
+	// Lenient parsing skips the malformed lines.
+	f, err := ParseFrame(malformed)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := f.Objects["1-0:1.8.1"]; !ok {
+		t.Error("key 1-0:1.8.1 not found")
+	}
+
+	// An empty power failure log and an M-Bus reading without capture time
+	// are valid lines.
+	for _, valid := range []string{frame, "/XMX5LGBBFG1009421637\r\n\r\n" +
+		"1-0:99.97.0()(0-0:96.7.19)\r\n" +
+		"0-1:24.2.3(1234ABC)(00001.234*m3)\r\n" +
+		"!\r\n"} {
+		f, err = Parser{Strict: true}.ParseFrame(valid)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if d := f.MBusDevices[1]; d.Value != 1.234 || !d.CaptureTime.IsZero() {
+			t.Errorf("gas device does not match %+v", d)
+		}
+	}
+
+	f, err = Parser{Strict: true}.ParseFrame(malformed)
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	want := []LineError{
+		{Line: 4, Text: "0-0:1.0.0(1610011353S)", Reason: ReasonInvalidTimestamp},
+		{Line: 5, Text: "garbage", Reason: ReasonNoObject},
+		{Line: 7, Text: "0-1:24.2.1(101209112500W)(abc*m3)", Reason: ReasonInvalidValue},
+	}
+	if len(parseErr.Errors) != len(want) {
+		t.Fatalf("size does not match %d != %d: %v", len(parseErr.Errors), len(want), parseErr)
+	}
+	for i, w := range want {
+		got := parseErr.Errors[i]
+		if got.Line != w.Line || got.Text != w.Text || got.Reason != w.Reason {
+			t.Errorf("error %d does not match %+v != %+v", i, got, w)
+		}
+	}
+	// The valid lines are still parsed.
+	if f.Version != "42" {
+		t.Errorf("version does not match %q != %q", f.Version, "42")
+	}
+}
+
+func TestParseTextMessage(t *testing.T) {
+	f, err := ParseFrame("/XMX5LGBBFG1009421637\r\n\r\n" +
+		"0-0:96.13.1(3031323334353637)\r\n" +
+		"0-0:96.13.0(4F6E646572686F75642030312D30312D32303236)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TextMessageCode != "01234567" {
+		t.Errorf("code does not match %q != %q", f.TextMessageCode, "01234567")
+	}
+	if f.TextMessage != "Onderhoud 01-01-2026" {
+		t.Errorf("message does not match %q != %q", f.TextMessage, "Onderhoud 01-01-2026")
+	}
+	if got := f.Objects["0-0:96.13.0"].Value; got != "4F6E646572686F75642030312D30312D32303236" {
+		t.Errorf("raw message not kept %q", got)
+	}
+
+	// Non-ASCII messages in UTF-8 or ISO-8859-1.
+	for value, want := range map[string]string{
+		"436F7570757265207072C3A9767565": "Coupure prévue",
+		"436F7570757265207072E9767565":   "Coupure prévue",
+	} {
+		if got := decodeText(value); got != want {
+			t.Errorf("text does not match %q != %q", got, want)
+		}
+	}
+
+	// Values that are not hex encoded are kept as is.
+	if got := decodeText("Hello"); got != "Hello" {
+		t.Errorf("text does not match %q != %q", got, "Hello")
+	}
+	if got := decodeText("0102"); got != "0102" {
+		t.Errorf("text does not match %q != %q", got, "0102")
+	}
+}
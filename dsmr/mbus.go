@@ -0,0 +1,135 @@
+package dsmr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// M-Bus device types as found in 0-n:24.1.0.
+const (
+	DeviceTypeElectricity = 0x02
+	DeviceTypeGas         = 0x03
+	DeviceTypeHeat        = 0x04
+	DeviceTypeWarmWater   = 0x06
+	DeviceTypeWater       = 0x07
+	DeviceTypeCooling     = 0x0A
+	DeviceTypeHeatInlet   = 0x0C
+	DeviceTypeHeatCooling = 0x0D
+)
+
+var deviceTypeNames = map[int]string{
+	DeviceTypeElectricity: "electricity",
+	DeviceTypeGas:         "gas",
+	DeviceTypeHeat:        "heat",
+	DeviceTypeWarmWater:   "warm_water",
+	DeviceTypeWater:       "water",
+	DeviceTypeCooling:     "cooling",
+	DeviceTypeHeatInlet:   "heat",
+	DeviceTypeHeatCooling: "heat_cooling",
+}
+
+// mbusRegexp matches the OBIS reference of M-Bus objects with 2 groups:
+//   - Channel eg `1`
+//   - Object eg `24.2.1`
+var mbusRegexp = regexp.MustCompile("^0-([1-9][0-9]*):(24\\.1\\.0|96\\.1\\.0|24\\.2\\.1|24\\.2\\.3|24\\.3\\.0|24\\.4\\.0)$")
+
+// MBusDevice is a gas, water, thermal or slave electricity meter that is
+// connected to the meter on an M-Bus channel.
+type MBusDevice struct {
+	Channel     int
+	DeviceType  int
+	EquipmentID string
+
+	// Value and Unit hold the last reading of the device, captured at
+	// CaptureTime.
+	Value       float64
+	Unit        string
+	CaptureTime time.Time
+
+	// ValvePosition is the valve or switch position (on/off/released), if
+	// the device has one.
+	ValvePosition string
+}
+
+// DeviceTypeName returns a name like gas or water for the device type.
+func (d MBusDevice) DeviceTypeName() string {
+	if name, ok := deviceTypeNames[d.DeviceType]; ok {
+		return name
+	}
+	return strconv.Itoa(d.DeviceType)
+}
+
+// HasReading reports if a reading of the device was found in the frame.
+func (d MBusDevice) HasReading() bool {
+	return d.Unit != ""
+}
+
+// updateMBus sets the field of the M-Bus device for obj, if obj is an
+// M-Bus object.
+func (f *Frame) updateMBus(obj DataObject, loc *time.Location) (err error) {
+	m := mbusRegexp.FindStringSubmatch(obj.ID)
+	if m == nil {
+		return nil
+	}
+	channel, _ := strconv.Atoi(m[1])
+	if f.MBusDevices == nil {
+		f.MBusDevices = make(map[int]MBusDevice)
+	}
+	d := f.MBusDevices[channel]
+	d.Channel = channel
+	defer func() { f.MBusDevices[channel] = d }()
+
+	var capture, reading ObjectValue
+	switch v := obj.Values; m[2] {
+	case "24.1.0":
+		d.DeviceType, err = strconv.Atoi(obj.Value)
+		return err
+	case "96.1.0":
+		d.EquipmentID = obj.Value
+		return nil
+	case "24.4.0":
+		d.ValvePosition = obj.Value
+		return nil
+	case "24.2.1", "24.2.3":
+		// (capture time)(value*unit)
+		if len(v) != 2 {
+			return fmt.Errorf("expected 2 values, got %d", len(v))
+		}
+		capture, reading = v[0], v[1]
+	case "24.3.0":
+		// DSMR 2.2/3.0: (capture time)(..)(..)(..)(OBIS)(unit)(value)
+		if len(v) != 7 {
+			return fmt.Errorf("expected 7 values, got %d", len(v))
+		}
+		capture, reading = v[0], ObjectValue{Value: v[6].Value, Unit: v[5].Value}
+	}
+	value, err := reading.Float()
+	if err != nil {
+		return err
+	}
+	d.Value, d.Unit = value, reading.Unit
+	// Some meters send something else, like a serial number, instead of
+	// the capture time.
+	if !timestampRegexp.MatchString(capture.Value) {
+		return nil
+	}
+	d.CaptureTime, err = parseTimestamp(capture.Value, loc)
+	return err
+}
+
+// GasDevice returns the gas meter with the lowest channel. A device with a
+// reading in m3 but without a device type is assumed to be a gas meter.
+func (f Frame) GasDevice() (MBusDevice, bool) {
+	var gas MBusDevice
+	found := false
+	for _, d := range f.MBusDevices {
+		isGas := d.DeviceType == DeviceTypeGas ||
+			(d.DeviceType == 0 && d.Unit == "m3")
+		if isGas && (!found || d.Channel < gas.Channel) {
+			gas, found = d, true
+		}
+	}
+	return gas, found
+}
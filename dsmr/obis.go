@@ -0,0 +1,71 @@
+package dsmr
+
+import "strings"
+
+// descriptions are the names of the objects in the DSMR and e-MUCS
+// specifications.
+var descriptions = map[string]string{
+	"1-3:0.2.8":   "Version information for P1 output",
+	"0-0:96.1.4":  "Version information of the e-MUCS specification",
+	"0-0:1.0.0":   "Date-time stamp of the P1 message",
+	"0-0:96.1.1":  "Equipment identifier",
+	"1-0:1.8.1":   "Electricity delivered to client (tariff 1)",
+	"1-0:1.8.2":   "Electricity delivered to client (tariff 2)",
+	"1-0:2.8.1":   "Electricity delivered by client (tariff 1)",
+	"1-0:2.8.2":   "Electricity delivered by client (tariff 2)",
+	"0-0:96.14.0": "Tariff indicator electricity",
+	"1-0:1.4.0":   "Current average demand of active energy import",
+	"1-0:1.6.0":   "Maximum demand of active energy import of the running month",
+	"0-0:98.1.0":  "Maximum demand of active energy import of the last 13 months",
+	"1-0:1.7.0":   "Actual electricity power delivered (+P)",
+	"1-0:2.7.0":   "Actual electricity power received (-P)",
+	"0-0:17.0.0":  "Actual threshold electricity",
+	"0-0:96.3.10": "Switch position electricity",
+	"0-0:96.7.21": "Number of power failures in any phase",
+	"0-0:96.7.9":  "Number of long power failures in any phase",
+	"1-0:99.97.0": "Power failure event log",
+	"1-0:32.32.0": "Number of voltage sags in phase L1",
+	"1-0:52.32.0": "Number of voltage sags in phase L2",
+	"1-0:72.32.0": "Number of voltage sags in phase L3",
+	"1-0:32.36.0": "Number of voltage swells in phase L1",
+	"1-0:52.36.0": "Number of voltage swells in phase L2",
+	"1-0:72.36.0": "Number of voltage swells in phase L3",
+	"0-0:96.13.1": "Text message code",
+	"0-0:96.13.0": "Text message",
+	"1-0:32.7.0":  "Instantaneous voltage L1",
+	"1-0:52.7.0":  "Instantaneous voltage L2",
+	"1-0:72.7.0":  "Instantaneous voltage L3",
+	"1-0:31.7.0":  "Instantaneous current L1",
+	"1-0:51.7.0":  "Instantaneous current L2",
+	"1-0:71.7.0":  "Instantaneous current L3",
+	"1-0:21.7.0":  "Instantaneous active power L1 (+P)",
+	"1-0:41.7.0":  "Instantaneous active power L2 (+P)",
+	"1-0:61.7.0":  "Instantaneous active power L3 (+P)",
+	"1-0:22.7.0":  "Instantaneous active power L1 (-P)",
+	"1-0:42.7.0":  "Instantaneous active power L2 (-P)",
+	"1-0:62.7.0":  "Instantaneous active power L3 (-P)",
+}
+
+// mbusDescriptions are the names of the objects of an M-Bus device.
+var mbusDescriptions = map[string]string{
+	"24.1.0": "Device type",
+	"96.1.0": "Equipment identifier",
+	"24.2.1": "Last reading",
+	"24.2.3": "Last reading",
+	"24.3.0": "Last hourly reading",
+	"24.4.0": "Valve position",
+}
+
+// Describe returns the name of the object with the given OBIS reference as
+// used in the specification, or an empty string for unknown objects.
+func Describe(id string) string {
+	if d, found := descriptions[id]; found {
+		return d
+	}
+	if m := mbusIDRegexp.FindStringSubmatch(id); m != nil {
+		if d, found := mbusDescriptions[m[2]]; found {
+			return "M-Bus channel " + m[1] + ": " + strings.ToLower(d[:1]) + d[1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,17 @@
+package dsmr
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	tests := map[string]string{
+		"1-0:1.8.1":   "Electricity delivered to client (tariff 1)",
+		"0-2:24.2.1":  "M-Bus channel 2: last reading",
+		"0-1:96.1.0":  "M-Bus channel 1: equipment identifier",
+		"0-0:96.99.9": "",
+	}
+	for id, want := range tests {
+		if got := Describe(id); got != want {
+			t.Errorf("description of %s does not match %q != %q", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package dsmr
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PowerFailure is an entry of the power failure event log which holds the
+// long power failures in any phase.
+type PowerFailure struct {
+	// End is the time the power returned.
+	End      time.Time
+	Duration time.Duration
+}
+
+// parsePowerFailureLog parses the buffer of the power failure event log
+// 1-0:99.97.0 which is formatted as:
+//
+//	(count)(0-0:96.7.19)(timestamp)(duration*s)...
+func parsePowerFailureLog(values []ObjectValue, loc *time.Location) ([]PowerFailure, error) {
+	if len(values) < 2 {
+		return nil, fmt.Errorf("expected at least 2 values, got %d", len(values))
+	}
+	// Meters without any logged failures may leave the count empty.
+	n := 0
+	if count := values[0].Value; count != "" {
+		var err error
+		if n, err = strconv.Atoi(count); err != nil {
+			return nil, err
+		}
+	}
+	entries := values[2:]
+	if len(entries) != n*2 {
+		return nil, fmt.Errorf("expected %d entries, got %d values", n, len(entries))
+	}
+	failures := make([]PowerFailure, 0, n)
+	for i := 0; i < len(entries); i += 2 {
+		end, err := parseTimestamp(entries[i].Value, loc)
+		if err != nil {
+			return nil, err
+		}
+		v, err := entries[i+1].Float()
+		if err != nil {
+			return nil, err
+		}
+		if unit := entries[i+1].Unit; unit != "s" {
+			return nil, fmt.Errorf("unexpected unit %q for duration", unit)
+		}
+		failures = append(failures, PowerFailure{
+			End:      end,
+			Duration: time.Duration(v) * time.Second,
+		})
+	}
+	return failures, nil
+}
@@ -7,15 +7,80 @@ import (
 	"log"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/basvdlei/gotsmart/dsmr"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// frameDescs are the descriptions of metrics that are not created by a
+// MetricBuilder.
+var frameDescs = []*prometheus.Desc{
+	maximumDemandTimestampDesc,
+	demandHistoryTimestampDesc,
+	lastPowerFailureEndDesc,
+	lastPowerFailureDurationDesc,
+	powerFailureDurationDesc,
+	mbusCaptureTimestampDesc,
+	mbusValvePositionDesc,
+	gasCaptureTimestampDesc,
+	textMessageInfoDesc,
+	textMessageChangesDesc,
+	lastFrameTimestampDesc,
+	frameAgeDesc,
+	unitMismatchesDesc,
+	valueErrorsDesc,
+}
+
+var (
+	unitMismatchesDesc = prometheus.NewDesc(
+		namespace+"_unit_mismatches_total",
+		"number of values dropped because their unit does not meet the spec",
+		[]string{"object"},
+		prometheus.Labels{},
+	)
+	valueErrorsDesc = prometheus.NewDesc(
+		namespace+"_value_parse_errors_total",
+		"number of values dropped because they could not be parsed as number",
+		[]string{"object"},
+		prometheus.Labels{},
+	)
+)
+
 // DSMRCollector implements the Prometheus Collector interface.
 type DSMRCollector struct {
 	sync.Mutex
 	metrics []prometheus.Metric
+
+	// State to count changes of the text message.
+	seenFrame          bool
+	textMessage        string
+	textMessageChanges float64
+
+	// Receive time and labels of the last frame for the frame age.
+	received    time.Time
+	frameLabels []string
+
+	// Durations of the power failures and the end times of the failures in
+	// the last power failure log.
+	powerFailures    *prometheus.HistogramVec
+	powerFailureEnds map[int64]bool
+
+	// Values dropped by object.
+	unitMismatches map[string]float64
+	valueErrors    map[string]float64
+
+	// UseCaptureTimestamps sets the timestamp of gas and other M-Bus
+	// readings to their capture time instead of the scrape time.
+	UseCaptureTimestamps bool
+	// UseFrameTimestamps sets the timestamp of the metrics to the
+	// timestamp of the frame instead of the scrape time. With
+	// UseCaptureTimestamps M-Bus readings keep their capture time.
+	UseFrameTimestamps bool
+	// UseBaseUnits exports the values of objects in base SI units, like
+	// gotsmart_electricity_power_delivered_watts instead of
+	// gotsmart_electricity_power_delivered_kw.
+	UseBaseUnits bool
 }
 
 // Collect implements part of the prometheus.Collector interface.
@@ -25,31 +90,97 @@ func (dc *DSMRCollector) Collect(ch chan<- prometheus.Metric) {
 	for _, m := range dc.metrics {
 		ch <- m
 	}
+	if dc.powerFailures != nil {
+		dc.powerFailures.Collect(ch)
+	}
+	for id, v := range dc.unitMismatches {
+		ch <- prometheus.MustNewConstMetric(unitMismatchesDesc, prometheus.CounterValue, v, id)
+	}
+	for id, v := range dc.valueErrors {
+		ch <- prometheus.MustNewConstMetric(valueErrorsDesc, prometheus.CounterValue, v, id)
+	}
+	if !dc.received.IsZero() {
+		// Invalid labels were already logged by Update.
+		m, err := prometheus.NewConstMetric(
+			frameAgeDesc,
+			prometheus.GaugeValue,
+			time.Since(dc.received).Seconds(),
+			dc.frameLabels...,
+		)
+		if err == nil {
+			ch <- m
+		}
+	}
+}
+
+// appendConstMetric appends a new constant metric to metrics. The label
+// values come from the frame and may be invalid, like an equipment
+// identifier garbled by line noise, in which case the metric is skipped.
+func appendConstMetric(metrics []prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) []prometheus.Metric {
+	m, err := prometheus.NewConstMetric(desc, valueType, value, labels...)
+	if err != nil {
+		log.Printf("could not create prometheus metric %s: %v\n", desc, err)
+		return metrics
+	}
+	return append(metrics, m)
 }
 
 // Describe implements part of the prometheus.Collector interface.
 func (dc *DSMRCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, mb := range metricBuilders {
-		ch <- mb.Desc
+		if dc.UseBaseUnits && mb.BaseDesc != nil {
+			ch <- mb.BaseDesc
+		} else {
+			ch <- mb.Desc
+		}
+	}
+	for _, desc := range frameDescs {
+		ch <- desc
+	}
+	if dc.UseBaseUnits {
+		ch <- demandHistoryBaseDesc
+		for _, desc := range mbusReadingBaseDescs {
+			ch <- desc
+		}
+	} else {
+		ch <- demandHistoryDesc
+		for _, desc := range mbusReadingDescs {
+			ch <- desc
+		}
 	}
 }
 
 // Update all the metrics to the values of the given frame.
 func (dc *DSMRCollector) Update(f dsmr.Frame) {
 	var metrics []prometheus.Metric
-	for _, obj := range f.Objects {
-		if mb, found := metricBuilders[obj.ID]; found {
-			if !mb.CheckUnit(obj.Unit) {
-				log.Printf("unit in object does not meet spec: %s\n", obj)
-				continue
-			}
+	var unitMismatches, valueErrors []string
+	seen := make(map[string]bool)
+	gas, gasFound := f.GasDevice()
+	for _, obj := range f.SortedObjects() {
+		id := builderID(f, obj.ID)
+		if seen[id] {
+			log.Printf("duplicate object for metric: %s\n", obj)
+			continue
+		}
+		if mb, found := metricBuilders[id]; found {
 			value, err := strconv.ParseFloat(obj.Value, 64)
 			if err != nil {
 				log.Printf("could not parse value to float64 for %s\n", obj)
+				valueErrors = append(valueErrors, obj.ID)
 				continue
 			}
+			value, ok := mb.Convert(value, obj.Unit)
+			if !ok {
+				log.Printf("unit in object does not meet spec: %s\n", obj)
+				unitMismatches = append(unitMismatches, obj.ID)
+				continue
+			}
+			desc := mb.Desc
+			if dc.UseBaseUnits && mb.BaseDesc != nil {
+				desc, value = mb.BaseDesc, value*mb.BaseScale
+			}
 			m, err := prometheus.NewConstMetric(
-				mb.Desc,
+				desc,
 				mb.ValueType,
 				value,
 				f.EquipmentID, f.Version, //labels
@@ -58,12 +189,46 @@ func (dc *DSMRCollector) Update(f dsmr.Frame) {
 				log.Printf("could not create prometheus metric for %s\n", obj)
 				continue
 			}
+			if gasFound && id == gasID &&
+				dc.UseCaptureTimestamps && !gas.CaptureTime.IsZero() {
+				m = prometheus.NewMetricWithTimestamp(gas.CaptureTime, m)
+			} else if dc.UseFrameTimestamps && !f.Timestamp.IsZero() {
+				m = prometheus.NewMetricWithTimestamp(f.Timestamp, m)
+			}
+			seen[id] = true
 			metrics = append(metrics, m)
 		} else {
 			continue
 		}
 	}
+	var frameMetrics []prometheus.Metric
+	frameMetrics = append(frameMetrics, demandMetrics(f, dc.UseBaseUnits)...)
+	frameMetrics = append(frameMetrics, dc.powerFailureMetrics(f)...)
+	frameMetrics = append(frameMetrics, gasMetrics(f)...)
+	frameMetrics = append(frameMetrics, dc.textMessageMetrics(f)...)
+	mbus := mbusMetrics(f, dc.UseCaptureTimestamps, dc.UseBaseUnits)
+	if dc.UseFrameTimestamps && !f.Timestamp.IsZero() {
+		withTimestamp(f.Timestamp, frameMetrics)
+		if !dc.UseCaptureTimestamps {
+			withTimestamp(f.Timestamp, mbus)
+		}
+	}
+	metrics = append(metrics, frameMetrics...)
+	metrics = append(metrics, mbus...)
+	metrics = append(metrics, lastFrameMetrics(f)...)
 	dc.Lock()
 	defer dc.Unlock()
 	dc.metrics = metrics
+	dc.received = time.Now()
+	dc.frameLabels = []string{f.EquipmentID, f.Version}
+	if dc.unitMismatches == nil {
+		dc.unitMismatches = make(map[string]float64)
+		dc.valueErrors = make(map[string]float64)
+	}
+	for _, id := range unitMismatches {
+		dc.unitMismatches[id]++
+	}
+	for _, id := range valueErrors {
+		dc.valueErrors[id]++
+	}
 }
@@ -1,6 +1,7 @@
 package prometheus
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -35,3 +36,429 @@ func TestDSMRCollector(t *testing.T) {
 	t.Logf("Metric: %s\n", <-ch)
 	t.Logf("Metric: %s\n", <-ch)
 }
+
+func TestDSMRCollectorRegistry(t *testing.T) {
+	f := dsmr.Frame{
+		EquipmentID: "1234",
+		Version:     "50217",
+		MaximumDemand: dsmr.Demand{
+			Time:  time.Date(2020, 5, 9, 13, 45, 58, 0, time.UTC),
+			Value: 2.589,
+			Unit:  "kW",
+		},
+		DemandHistory: []dsmr.Demand{{
+			Month: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+			Time:  time.Date(2020, 4, 23, 19, 25, 38, 0, time.UTC),
+			Value: 3.695,
+			Unit:  "kW",
+		}},
+		PowerFailures: []dsmr.PowerFailure{{
+			End:      time.Date(2010, 12, 8, 15, 24, 15, 0, time.UTC),
+			Duration: 240 * time.Second,
+		}},
+		MBusDevices: map[int]dsmr.MBusDevice{
+			2: {
+				Channel:     2,
+				DeviceType:  dsmr.DeviceTypeWater,
+				EquipmentID: "3232323241424344313233343536373839",
+				Value:       12.785,
+				Unit:        "m3",
+				CaptureTime: time.Date(2010, 12, 9, 11, 25, 0, 0, time.UTC),
+			},
+		},
+		Objects: frame.Objects,
+	}
+	dc := &DSMRCollector{}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(dc); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, mf := range mfs {
+		got[mf.GetName()] = true
+	}
+	for _, name := range []string{
+		"gotsmart_electricity_delivered_to_client_tariff_1_kwh",
+		"gotsmart_maximum_demand_timestamp_seconds",
+		"gotsmart_maximum_demand_history_kw",
+		"gotsmart_last_power_failure_duration_seconds",
+		"gotsmart_power_failure_duration_seconds",
+		"gotsmart_mbus_reading_m3",
+		"gotsmart_mbus_capture_timestamp_seconds",
+	} {
+		if !got[name] {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
+
+func TestDSMRCollectorCaptureTimestamps(t *testing.T) {
+	captured := time.Date(2010, 12, 9, 11, 25, 0, 0, time.UTC)
+	f := dsmr.Frame{
+		MBusDevices: map[int]dsmr.MBusDevice{
+			1: {
+				Channel:     1,
+				DeviceType:  dsmr.DeviceTypeGas,
+				Value:       12785.123,
+				Unit:        "m3",
+				CaptureTime: captured,
+			},
+		},
+		Objects: map[string]dsmr.DataObject{
+			"0-1:24.2.1": {
+				ID:    "0-1:24.2.1",
+				Value: "12785.123",
+				Unit:  "m3",
+			},
+		},
+	}
+	dc := &DSMRCollector{UseCaptureTimestamps: true}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "gotsmart_gas_m3", "gotsmart_mbus_reading_m3":
+			if ts := mf.GetMetric()[0].GetTimestampMs(); ts != captured.UnixNano()/int64(time.Millisecond) {
+				t.Errorf("%s: timestamp does not match %d", mf.GetName(), ts)
+			}
+		case "gotsmart_gas_capture_timestamp_seconds":
+			if v := mf.GetMetric()[0].GetGauge().GetValue(); v != float64(captured.Unix()) {
+				t.Errorf("%s: value does not match %f", mf.GetName(), v)
+			}
+		}
+		found[mf.GetName()] = true
+	}
+	for _, name := range []string{"gotsmart_gas_m3", "gotsmart_mbus_reading_m3", "gotsmart_gas_capture_timestamp_seconds"} {
+		if !found[name] {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
+
+func TestDSMRCollectorFrameTimestamps(t *testing.T) {
+	sent := time.Now().Add(-time.Minute).Truncate(time.Second)
+	f := dsmr.Frame{
+		Timestamp: sent,
+		Objects:   frame.Objects,
+	}
+	dc := &DSMRCollector{UseFrameTimestamps: true}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, mf := range mfs {
+		m := mf.GetMetric()[0]
+		switch mf.GetName() {
+		case "gotsmart_electricity_delivered_to_client_tariff_1_kwh":
+			if ts := m.GetTimestampMs(); ts != sent.UnixNano()/int64(time.Millisecond) {
+				t.Errorf("%s: timestamp does not match %d", mf.GetName(), ts)
+			}
+		case "gotsmart_last_frame_timestamp_seconds":
+			if v := m.GetGauge().GetValue(); v != float64(sent.Unix()) {
+				t.Errorf("%s: value does not match %f", mf.GetName(), v)
+			}
+		case "gotsmart_frame_age_seconds":
+			// The age is measured from the receive time, not the clock
+			// of the meter.
+			if v := m.GetGauge().GetValue(); v < 0 || v > 10 {
+				t.Errorf("%s: value does not match %f", mf.GetName(), v)
+			}
+			if m.TimestampMs != nil {
+				t.Errorf("%s: unexpected timestamp", mf.GetName())
+			}
+		}
+		found[mf.GetName()] = true
+	}
+	for _, name := range []string{"gotsmart_electricity_delivered_to_client_tariff_1_kwh", "gotsmart_last_frame_timestamp_seconds", "gotsmart_frame_age_seconds"} {
+		if !found[name] {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
+
+func TestDSMRCollectorTextMessageChanges(t *testing.T) {
+	dc := &DSMRCollector{}
+	for _, msg := range []string{"", "", "storing", "storing", ""} {
+		dc.Update(dsmr.Frame{TextMessage: msg})
+	}
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "gotsmart_text_message_changes_total" {
+			if v := mf.GetMetric()[0].GetCounter().GetValue(); v != 2 {
+				t.Errorf("changes do not match %f != %d", v, 2)
+			}
+			return
+		}
+	}
+	t.Error("metric gotsmart_text_message_changes_total not found")
+}
+
+func TestLookup(t *testing.T) {
+	f := dsmr.Frame{
+		MBusDevices: map[int]dsmr.MBusDevice{
+			1: {Channel: 1, DeviceType: dsmr.DeviceTypeWater, Unit: "m3"},
+			2: {Channel: 2, DeviceType: dsmr.DeviceTypeGas, Unit: "m3"},
+		},
+	}
+	mb, found := Lookup(f, "0-2:24.2.1")
+	if !found {
+		t.Fatal("builder for 0-2:24.2.1 not found")
+	}
+	if mb.Name != "gotsmart_gas_m3" || mb.Unit != "m3" {
+		t.Errorf("builder does not match %q %q", mb.Name, mb.Unit)
+	}
+	// The water meter on channel 1 is not a gas meter.
+	for _, id := range []string{"0-1:24.2.1", "0-1:24.2.3", "0-0:96.1.1"} {
+		if _, found := Lookup(f, id); found {
+			t.Errorf("unexpected builder for %s", id)
+		}
+	}
+}
+
+func TestLookupLegacyGas(t *testing.T) {
+	f, err := dsmr.ParseFrame("/ISk5\\2ME382-1003\r\n\r\n" +
+		"0-1:24.1.0(7)\r\n" +
+		"0-2:24.1.0(3)\r\n" +
+		"0-2:24.3.0(121030140000)(00)(60)(1)(0-2:24.2.1)(m3)\r\n" +
+		"(00501.239)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mb, found := Lookup(f, "0-2:24.3.0"); !found || mb.Name != "gotsmart_gas_m3" {
+		t.Errorf("builder for 0-2:24.3.0 does not match %v %v", mb, found)
+	}
+}
+
+func TestDSMRCollectorGasChannel(t *testing.T) {
+	captured := time.Date(2010, 12, 9, 11, 25, 0, 0, time.UTC)
+	f := dsmr.Frame{
+		MBusDevices: map[int]dsmr.MBusDevice{
+			1: {Channel: 1, DeviceType: dsmr.DeviceTypeWater, Value: 345.678, Unit: "m3",
+				CaptureTime: captured.Add(-time.Hour)},
+			2: {Channel: 2, DeviceType: dsmr.DeviceTypeGas, Value: 12785.123, Unit: "m3",
+				CaptureTime: captured},
+		},
+		Objects: map[string]dsmr.DataObject{
+			"0-1:24.2.1": {ID: "0-1:24.2.1", Value: "00345.678", Unit: "m3"},
+			"0-2:24.2.1": {ID: "0-2:24.2.1", Value: "12785.123", Unit: "m3"},
+		},
+	}
+	dc := &DSMRCollector{UseCaptureTimestamps: true}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "gotsmart_gas_m3" {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("size does not match %d != %d", len(mf.GetMetric()), 1)
+		}
+		m := mf.GetMetric()[0]
+		if v := m.GetCounter().GetValue(); v != 12785.123 {
+			t.Errorf("value does not match %f", v)
+		}
+		if ts := m.GetTimestampMs(); ts != captured.UnixNano()/int64(time.Millisecond) {
+			t.Errorf("timestamp does not match %d", ts)
+		}
+		return
+	}
+	t.Error("metric gotsmart_gas_m3 not found")
+}
+
+func TestDSMRCollectorDroppedValues(t *testing.T) {
+	f := dsmr.Frame{
+		Objects: map[string]dsmr.DataObject{
+			"1-0:1.7.0": {ID: "1-0:1.7.0", Value: "01.193", Unit: "V"},
+			"1-0:2.7.0": {ID: "1-0:2.7.0", Value: "bogus", Unit: "kW"},
+		},
+	}
+	dc := &DSMRCollector{}
+	dc.Update(f)
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"gotsmart_unit_mismatches_total":    "1-0:1.7.0",
+		"gotsmart_value_parse_errors_total": "1-0:2.7.0",
+	}
+	for _, mf := range mfs {
+		id, found := want[mf.GetName()]
+		if !found {
+			continue
+		}
+		m := mf.GetMetric()[0]
+		if l := m.GetLabel()[0].GetValue(); l != id {
+			t.Errorf("%s: object does not match %q != %q", mf.GetName(), l, id)
+		}
+		if v := m.GetCounter().GetValue(); v != 2 {
+			t.Errorf("%s: value does not match %f != %d", mf.GetName(), v, 2)
+		}
+		delete(want, mf.GetName())
+	}
+	for name := range want {
+		t.Errorf("metric %s not found", name)
+	}
+}
+
+func TestDSMRCollectorBaseUnits(t *testing.T) {
+	f := dsmr.Frame{
+		Objects: map[string]dsmr.DataObject{
+			"1-0:1.8.1":   {ID: "1-0:1.8.1", Value: "000093.179", Unit: "kWh"},
+			"1-0:1.7.0":   {ID: "1-0:1.7.0", Value: "1193", Unit: "W"},
+			"0-0:96.14.0": {ID: "0-0:96.14.0", Value: "0001"},
+		},
+		DemandHistory: []dsmr.Demand{{
+			Month: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+			Time:  time.Date(2020, 4, 23, 19, 25, 38, 0, time.UTC),
+			Value: 3.695,
+			Unit:  "kW",
+		}},
+		MBusDevices: map[int]dsmr.MBusDevice{
+			2: {Channel: 2, DeviceType: dsmr.DeviceTypeWater, Value: 12.5, Unit: "m³"},
+			3: {Channel: 3, DeviceType: dsmr.DeviceTypeHeat, Value: 1.23, Unit: "GJ"},
+		},
+	}
+	dc := &DSMRCollector{UseBaseUnits: true}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"gotsmart_electricity_delivered_to_client_tariff_1_joules_total": 93.179 * 3.6e6,
+		"gotsmart_electricity_power_delivered_watts":                     1193,
+		"gotsmart_tariff_indicator_electricity":                          1,
+		"gotsmart_maximum_demand_history_watts":                          3695,
+		"gotsmart_mbus_reading_cubic_meters_total":                       12.5,
+		"gotsmart_mbus_reading_joules_total":                             1.23e9,
+	}
+	for _, mf := range mfs {
+		v, found := want[mf.GetName()]
+		if !found {
+			continue
+		}
+		m := mf.GetMetric()[0]
+		got := m.GetUntyped().GetValue() + m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		if math.Abs(got-v) > 1e-6 {
+			t.Errorf("%s: value does not match %f != %f", mf.GetName(), got, v)
+		}
+		delete(want, mf.GetName())
+	}
+	for name := range want {
+		t.Errorf("metric %s not found", name)
+	}
+}
+
+func TestDSMRCollectorPowerFailures(t *testing.T) {
+	failure := func(day int, d time.Duration) dsmr.PowerFailure {
+		return dsmr.PowerFailure{End: time.Date(2010, 12, day, 15, 0, 0, 0, time.UTC), Duration: d}
+	}
+	dc := &DSMRCollector{}
+	dc.Update(dsmr.Frame{PowerFailures: []dsmr.PowerFailure{
+		failure(2, 600*time.Second), failure(1, 240*time.Second),
+	}})
+	// The oldest failure rotated out of the log.
+	dc.Update(dsmr.Frame{PowerFailures: []dsmr.PowerFailure{
+		failure(3, 1000*time.Second), failure(2, 600*time.Second),
+	}})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "gotsmart_power_failure_duration_seconds" {
+			h := mf.GetMetric()[0].GetHistogram()
+			if h.GetSampleCount() != 3 || h.GetSampleSum() != 1840 {
+				t.Errorf("histogram does not match %d %f", h.GetSampleCount(), h.GetSampleSum())
+			}
+			return
+		}
+	}
+	t.Error("metric gotsmart_power_failure_duration_seconds not found")
+}
+
+func TestDSMRCollectorLatin1TextMessage(t *testing.T) {
+	f, err := dsmr.ParseFrame("/XMX5LGBBFG1009421637\r\n\r\n" +
+		"0-0:96.13.0(436F7570757265207072E9767565)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := &DSMRCollector{}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "gotsmart_text_message_info" {
+			continue
+		}
+		for _, l := range mf.GetMetric()[0].GetLabel() {
+			if l.GetName() == "message" && l.GetValue() != "Coupure prévue" {
+				t.Errorf("message does not match %q", l.GetValue())
+			}
+		}
+		return
+	}
+	t.Error("metric gotsmart_text_message_info not found")
+}
+
+func TestDSMRCollectorInvalidLabels(t *testing.T) {
+	f, err := dsmr.ParseFrame("/ISk5\\2ME382-1003\r\n\r\n" +
+		"0-0:96.1.1(\xff\xfe)\r\n" +
+		"1-0:1.8.1(00264.129*kWh)\r\n" +
+		"1-0:99.97.0(1)(0-0:96.7.19)(101208152415W)(0000000240*s)\r\n" +
+		"0-0:96.13.0(4F6E646572686F7564)\r\n" +
+		"0-1:24.1.0(3)\r\n" +
+		"0-1:96.1.0(\xff)\r\n" +
+		"0-1:24.2.1(101209112500W)(12785.123*m3)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.MaximumDemand = dsmr.Demand{Time: time.Now(), Value: 2.589, Unit: "kW"}
+	dc := &DSMRCollector{}
+	dc.Update(f)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(dc)
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+package prometheus
+
+import (
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	maximumDemandTimestampDesc = prometheus.NewDesc(
+		namespace+"_maximum_demand_timestamp_seconds",
+		"time of the maximum demand in the running month",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+	demandHistoryDesc = prometheus.NewDesc(
+		namespace+"_maximum_demand_history_kw",
+		"maximum quarter-hourly average demand of previous months",
+		append(defaultLabels, "month"),
+		prometheus.Labels{},
+	)
+	demandHistoryBaseDesc = prometheus.NewDesc(
+		namespace+"_maximum_demand_history_watts",
+		"maximum quarter-hourly average demand of previous months",
+		append(defaultLabels, "month"),
+		prometheus.Labels{},
+	)
+	demandHistoryTimestampDesc = prometheus.NewDesc(
+		namespace+"_maximum_demand_history_timestamp_seconds",
+		"time of the maximum demand of previous months",
+		append(defaultLabels, "month"),
+		prometheus.Labels{},
+	)
+)
+
+// demandMetrics returns the metrics for the peak demands of Belgian meters.
+// The peaks are exported in watts when useBaseUnits is set.
+func demandMetrics(f dsmr.Frame, useBaseUnits bool) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	if !f.MaximumDemand.Time.IsZero() {
+		metrics = appendConstMetric(metrics,
+			maximumDemandTimestampDesc,
+			prometheus.GaugeValue,
+			float64(f.MaximumDemand.Time.Unix()),
+			f.EquipmentID, f.Version, //labels
+		)
+	}
+	for _, d := range f.DemandHistory {
+		value, ok := convertUnit(d.Value, d.Unit, "kW")
+		if !ok {
+			continue
+		}
+		desc := demandHistoryDesc
+		if useBaseUnits {
+			desc, value = demandHistoryBaseDesc, value*baseUnits["kW"].Scale
+		}
+		month := d.Month.Format("2006-01")
+		metrics = appendConstMetric(metrics,
+			desc,
+			prometheus.GaugeValue,
+			value,
+			f.EquipmentID, f.Version, month, //labels
+		)
+		metrics = appendConstMetric(metrics,
+			demandHistoryTimestampDesc,
+			prometheus.GaugeValue,
+			float64(d.Time.Unix()),
+			f.EquipmentID, f.Version, month, //labels
+		)
+	}
+	return metrics
+}
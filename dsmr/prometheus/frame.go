@@ -0,0 +1,52 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	lastFrameTimestampDesc = prometheus.NewDesc(
+		namespace+"_last_frame_timestamp_seconds",
+		"timestamp of the last frame as sent by the meter, or the receive time for meters without one",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+	frameAgeDesc = prometheus.NewDesc(
+		namespace+"_frame_age_seconds",
+		"time since the last frame was received",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+)
+
+// frameTime returns the timestamp of the frame, or the current time when
+// the meter does not send one.
+func frameTime(f dsmr.Frame) time.Time {
+	if f.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return f.Timestamp
+}
+
+// lastFrameMetrics returns the metrics for the time of the frame. The age
+// is calculated from the receive time when collecting instead, so a wrong
+// meter clock does not affect it.
+func lastFrameMetrics(f dsmr.Frame) []prometheus.Metric {
+	return appendConstMetric(nil,
+		lastFrameTimestampDesc,
+		prometheus.GaugeValue,
+		float64(frameTime(f).UnixNano())/1e9,
+		f.EquipmentID, f.Version, //labels
+	)
+}
+
+// withTimestamp sets the sample timestamp of all metrics to t.
+func withTimestamp(t time.Time, metrics []prometheus.Metric) []prometheus.Metric {
+	for i, m := range metrics {
+		metrics[i] = prometheus.NewMetricWithTimestamp(t, m)
+	}
+	return metrics
+}
@@ -0,0 +1,31 @@
+package prometheus
+
+import (
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gasID is the object of the gotsmart_gas_m3 metric.
+const gasID = "0-1:24.2.3"
+
+var gasCaptureTimestampDesc = prometheus.NewDesc(
+	namespace+"_gas_capture_timestamp_seconds",
+	"capture time of the last gas meter reading",
+	defaultLabels,
+	prometheus.Labels{},
+)
+
+// gasMetrics returns the metrics for the gas meter reading that are not
+// created by a MetricBuilder.
+func gasMetrics(f dsmr.Frame) []prometheus.Metric {
+	d, found := f.GasDevice()
+	if !found || d.CaptureTime.IsZero() {
+		return nil
+	}
+	return appendConstMetric(nil,
+		gasCaptureTimestampDesc,
+		prometheus.GaugeValue,
+		float64(d.CaptureTime.Unix()),
+		f.EquipmentID, f.Version, //labels
+	)
+}
@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var mbusLabels = append(defaultLabels, "channel", "device_type", "mbus_equipment_id")
+
+var (
+	// mbusReadingDescs holds the reading descriptions by unit.
+	mbusReadingDescs = map[string]*prometheus.Desc{
+		"m3": prometheus.NewDesc(
+			namespace+"_mbus_reading_m3",
+			"last meter reading of a gas or water meter on an m-bus channel in m3",
+			mbusLabels,
+			prometheus.Labels{},
+		),
+		"GJ": prometheus.NewDesc(
+			namespace+"_mbus_reading_gj",
+			"last meter reading of a heat or cold meter on an m-bus channel in gj",
+			mbusLabels,
+			prometheus.Labels{},
+		),
+		"kWh": prometheus.NewDesc(
+			namespace+"_mbus_reading_kwh",
+			"last meter reading of a slave electricity meter on an m-bus channel in kwh",
+			mbusLabels,
+			prometheus.Labels{},
+		),
+	}
+	// mbusReadingBaseDescs holds the reading descriptions by base unit.
+	mbusReadingBaseDescs = map[string]*prometheus.Desc{
+		"cubic_meters": prometheus.NewDesc(
+			namespace+"_mbus_reading_cubic_meters_total",
+			"last meter reading of a gas or water meter on an m-bus channel in cubic meters",
+			mbusLabels,
+			prometheus.Labels{},
+		),
+		"joules": prometheus.NewDesc(
+			namespace+"_mbus_reading_joules_total",
+			"last meter reading of a heat, cold or slave electricity meter on an m-bus channel in joules",
+			mbusLabels,
+			prometheus.Labels{},
+		),
+	}
+	mbusCaptureTimestampDesc = prometheus.NewDesc(
+		namespace+"_mbus_capture_timestamp_seconds",
+		"capture time of the last meter reading on an m-bus channel",
+		mbusLabels,
+		prometheus.Labels{},
+	)
+	mbusValvePositionDesc = prometheus.NewDesc(
+		namespace+"_mbus_valve_position",
+		"valve or switch position (on/off/released) of a device on an m-bus channel",
+		mbusLabels,
+		prometheus.Labels{},
+	)
+)
+
+// mbusReadingUnits are the units of the readings of M-Bus devices in the
+// specification.
+var mbusReadingUnits = []string{"m3", "GJ", "kWh"}
+
+// mbusReading returns the reading of d converted to one of mbusReadingUnits.
+func mbusReading(d dsmr.MBusDevice) (value float64, unit string, ok bool) {
+	for _, unit := range mbusReadingUnits {
+		if value, ok := convertUnit(d.Value, d.Unit, unit); ok {
+			return value, unit, true
+		}
+	}
+	return 0, "", false
+}
+
+// mbusMetrics returns the metrics for the devices on the M-Bus channels. The
+// readings get their capture time as timestamp when captureTimestamps is set
+// and are exported in base SI units when useBaseUnits is set.
+func mbusMetrics(f dsmr.Frame, captureTimestamps, useBaseUnits bool) []prometheus.Metric {
+	channels := make([]int, 0, len(f.MBusDevices))
+	for ch := range f.MBusDevices {
+		channels = append(channels, ch)
+	}
+	sort.Ints(channels)
+
+	var metrics []prometheus.Metric
+	for _, ch := range channels {
+		d := f.MBusDevices[ch]
+		labels := []string{
+			f.EquipmentID, f.Version,
+			strconv.Itoa(d.Channel), d.DeviceTypeName(), d.EquipmentID,
+		}
+		if d.HasReading() {
+			value, unit, found := mbusReading(d)
+			if !found {
+				log.Printf("unit of m-bus reading on channel %d is not supported: %s\n", d.Channel, d.Unit)
+			} else {
+				desc := mbusReadingDescs[unit]
+				if useBaseUnits {
+					base := baseUnits[unit]
+					desc, value = mbusReadingBaseDescs[base.Name], value*base.Scale
+				}
+				m, err := prometheus.NewConstMetric(
+					desc, prometheus.CounterValue, value, labels...)
+				if err != nil {
+					log.Printf("could not create prometheus metric for m-bus reading on channel %d: %v\n", d.Channel, err)
+				} else {
+					if captureTimestamps && !d.CaptureTime.IsZero() {
+						m = prometheus.NewMetricWithTimestamp(d.CaptureTime, m)
+					}
+					metrics = append(metrics, m)
+				}
+			}
+		}
+		if !d.CaptureTime.IsZero() {
+			metrics = appendConstMetric(metrics,
+				mbusCaptureTimestampDesc, prometheus.GaugeValue,
+				float64(d.CaptureTime.Unix()), labels...)
+		}
+		if v, err := strconv.ParseFloat(d.ValvePosition, 64); err == nil {
+			metrics = appendConstMetric(metrics,
+				mbusValvePositionDesc, prometheus.UntypedValue, v, labels...)
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"log"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// powerFailureBuckets are the upper bounds in seconds of the power failure
+// duration histogram. Only failures longer than 3 minutes are logged.
+var powerFailureBuckets = []float64{300, 900, 1800, 3600, 4 * 3600, 12 * 3600, 24 * 3600}
+
+var (
+	lastPowerFailureEndDesc = prometheus.NewDesc(
+		namespace+"_last_power_failure_end_timestamp_seconds",
+		"time the last logged long power failure ended",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+	lastPowerFailureDurationDesc = prometheus.NewDesc(
+		namespace+"_last_power_failure_duration_seconds",
+		"duration of the last logged long power failure",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+	powerFailureDurationDesc = prometheus.NewDesc(
+		namespace+"_power_failure_duration_seconds",
+		"durations of the long power failures in the power failure event log",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+)
+
+// newPowerFailureHistogram returns the histogram of the durations of the
+// power failures, described by powerFailureDurationDesc.
+func newPowerFailureHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "power_failure_duration_seconds",
+		Help:      "durations of the long power failures in the power failure event log",
+		Buckets:   powerFailureBuckets,
+	}, defaultLabels)
+}
+
+// powerFailureMetrics returns the metrics for the power failure event log.
+// The log only holds the last failures, so the collector observes the
+// duration of each failure once when it first appears in the log.
+func (dc *DSMRCollector) powerFailureMetrics(f dsmr.Frame) []prometheus.Metric {
+	if len(f.PowerFailures) == 0 {
+		return nil
+	}
+	dc.Lock()
+	if dc.powerFailures == nil {
+		dc.powerFailures = newPowerFailureHistogram()
+	}
+	h, err := dc.powerFailures.GetMetricWithLabelValues(f.EquipmentID, f.Version)
+	if err != nil {
+		log.Printf("could not create prometheus metric for power failures: %v\n", err)
+	} else {
+		ends := make(map[int64]bool, len(f.PowerFailures))
+		for _, pf := range f.PowerFailures {
+			end := pf.End.Unix()
+			if !dc.powerFailureEnds[end] {
+				h.Observe(pf.Duration.Seconds())
+			}
+			ends[end] = true
+		}
+		dc.powerFailureEnds = ends
+	}
+	dc.Unlock()
+
+	last := f.PowerFailures[0]
+	for _, pf := range f.PowerFailures {
+		if pf.End.After(last.End) {
+			last = pf
+		}
+	}
+	var metrics []prometheus.Metric
+	metrics = appendConstMetric(metrics,
+		lastPowerFailureEndDesc,
+		prometheus.GaugeValue,
+		float64(last.End.Unix()),
+		f.EquipmentID, f.Version, //labels
+	)
+	metrics = appendConstMetric(metrics,
+		lastPowerFailureDurationDesc,
+		prometheus.GaugeValue,
+		last.Duration.Seconds(),
+		f.EquipmentID, f.Version, //labels
+	)
+	return metrics
+}
@@ -0,0 +1,51 @@
+package prometheus
+
+import (
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	textMessageInfoDesc = prometheus.NewDesc(
+		namespace+"_text_message_info",
+		"text message sent by the grid operator",
+		append(defaultLabels, "code", "message"),
+		prometheus.Labels{},
+	)
+	textMessageChangesDesc = prometheus.NewDesc(
+		namespace+"_text_message_changes_total",
+		"number of times the text message of the grid operator changed",
+		defaultLabels,
+		prometheus.Labels{},
+	)
+)
+
+// textMessageMetrics returns the metrics for the text message of the frame.
+// Changes are counted by the collector since the first frame.
+func (dc *DSMRCollector) textMessageMetrics(f dsmr.Frame) []prometheus.Metric {
+	dc.Lock()
+	message := f.TextMessageCode + "\x00" + f.TextMessage
+	if dc.seenFrame && message != dc.textMessage {
+		dc.textMessageChanges++
+	}
+	dc.seenFrame = true
+	dc.textMessage = message
+	changes := dc.textMessageChanges
+	dc.Unlock()
+
+	metrics := appendConstMetric(nil,
+		textMessageChangesDesc,
+		prometheus.CounterValue,
+		changes,
+		f.EquipmentID, f.Version, //labels
+	)
+	if f.TextMessage != "" || f.TextMessageCode != "" {
+		metrics = appendConstMetric(metrics,
+			textMessageInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			f.EquipmentID, f.Version, f.TextMessageCode, f.TextMessage, //labels
+		)
+	}
+	return metrics
+}
@@ -0,0 +1,90 @@
+package prometheus
+
+import "strings"
+
+// unitAliases maps alternative spellings of units onto the spelling used by
+// the specification.
+var unitAliases = map[string]string{
+	"m³":  "m3",
+	"m^3": "m3",
+}
+
+// siPrefixes are the scales of the SI prefixes used by meters.
+var siPrefixes = map[string]float64{
+	"":  1,
+	"m": 1e-3,
+	"k": 1e3,
+	"M": 1e6,
+	"G": 1e9,
+}
+
+// prefixableUnits are the units that may have an SI prefix, longest first.
+var prefixableUnits = []string{"varh", "var", "Wh", "VA", "W", "V", "A", "J", "m3"}
+
+// parseUnit returns the scale and unit without SI prefix of a unit like kWh.
+// Units in the wrong case, like kwh or KW, are accepted as long as they are
+// not ambiguous, so only the k and G prefixes are recognized for those.
+func parseUnit(unit string) (scale float64, base string, ok bool) {
+	unit = strings.TrimSpace(unit)
+	if alias, found := unitAliases[unit]; found {
+		unit = alias
+	}
+	for _, base := range prefixableUnits {
+		if strings.HasSuffix(unit, base) {
+			if scale, found := siPrefixes[strings.TrimSuffix(unit, base)]; found {
+				return scale, base, true
+			}
+		}
+	}
+	lower := strings.ToLower(unit)
+	for _, base := range prefixableUnits {
+		if !strings.HasSuffix(lower, strings.ToLower(base)) {
+			continue
+		}
+		switch strings.TrimSuffix(lower, strings.ToLower(base)) {
+		case "":
+			return 1, base, true
+		case "k":
+			return 1e3, base, true
+		case "g":
+			return 1e9, base, true
+		}
+	}
+	return 0, "", false
+}
+
+// convertUnit converts value from unit from to unit to, which must only
+// differ in SI prefix or spelling.
+func convertUnit(value float64, from, to string) (float64, bool) {
+	if from == to {
+		return value, true
+	}
+	fromScale, fromBase, ok := parseUnit(from)
+	if !ok {
+		return 0, false
+	}
+	toScale, toBase, ok := parseUnit(to)
+	if !ok || fromBase != toBase {
+		return 0, false
+	}
+	return value * fromScale / toScale, true
+}
+
+// baseUnit is the base SI unit of a unit used by the specification.
+type baseUnit struct {
+	// Name is the suffix of the metric name, like joules.
+	Name string
+	// Scale converts a value into the base unit.
+	Scale float64
+}
+
+// baseUnits maps the units of the specification onto base SI units
+// following the Prometheus naming conventions.
+var baseUnits = map[string]baseUnit{
+	"kWh": {Name: "joules", Scale: 3.6e6},
+	"GJ":  {Name: "joules", Scale: 1e9},
+	"kW":  {Name: "watts", Scale: 1e3},
+	"V":   {Name: "volts", Scale: 1},
+	"A":   {Name: "amperes", Scale: 1},
+	"m3":  {Name: "cubic_meters", Scale: 1},
+}
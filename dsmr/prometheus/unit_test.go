@@ -0,0 +1,35 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		value float64
+		from  string
+		to    string
+		want  float64
+		ok    bool
+	}{
+		{value: 1.193, from: "kW", to: "kW", want: 1.193, ok: true},
+		{value: 1193, from: "W", to: "kW", want: 1.193, ok: true},
+		{value: 93179, from: "Wh", to: "kWh", want: 93.179, ok: true},
+		{value: 1.5, from: "MWh", to: "kWh", want: 1500, ok: true},
+		{value: 93.179, from: "kwh", to: "kWh", want: 93.179, ok: true},
+		{value: 1.193, from: "KW", to: "kW", want: 1.193, ok: true},
+		{value: 230.1, from: "v", to: "V", want: 230.1, ok: true},
+		{value: 12.5, from: "m³", to: "m3", want: 12.5, ok: true},
+		{value: 1.193, from: "V", to: "kW"},
+		{value: 1.193, from: "", to: "kW"},
+		{value: 1, from: "kW", to: ""},
+		{value: 1, from: "mw", to: "kW"},
+	}
+	for _, tt := range tests {
+		got, ok := convertUnit(tt.value, tt.from, tt.to)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%f %s to %s does not match %f %t != %f %t", tt.value, tt.from, tt.to, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package dsmr
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/basvdlei/gotsmart/crc16"
+)
+
+// DefaultMaxFrameSize is the maximum size of a frame accepted by a Reader
+// unless configured otherwise.
+const DefaultMaxFrameSize = 16 * 1024
+
+var (
+	// ErrTruncated is returned when the input ends in the middle of a frame.
+	ErrTruncated = errors.New("dsmr: truncated frame")
+	// ErrFrameTooLarge is returned when no end of frame is found within the
+	// maximum frame size.
+	ErrFrameTooLarge = errors.New("dsmr: frame exceeds maximum size")
+	// ErrMissingChecksum is returned when a frame that requires a CRC is not
+	// followed by one.
+	ErrMissingChecksum = errors.New("dsmr: missing CRC")
+)
+
+// Protocol selects which DSMR versions a Reader accepts.
+type Protocol int
+
+const (
+	// ProtocolAuto accepts frames without a CRC only when they lack the
+	// version object that DSMR 4 and later always send.
+	ProtocolAuto Protocol = iota
+	// ProtocolDSMR4 requires a CRC as used by DSMR 4.x and 5.x.
+	ProtocolDSMR4
+	// ProtocolDSMR3 accepts frames without a CRC as sent by DSMR 2.2 and
+	// 3.0 meters.
+	ProtocolDSMR3
+)
+
+// ParseProtocol returns the protocol for the names auto, dsmr4 and dsmr3.
+func ParseProtocol(s string) (Protocol, error) {
+	switch s {
+	case "auto":
+		return ProtocolAuto, nil
+	case "dsmr4":
+		return ProtocolDSMR4, nil
+	case "dsmr3":
+		return ProtocolDSMR3, nil
+	}
+	return ProtocolAuto, fmt.Errorf("dsmr: unknown protocol %q", s)
+}
+
+// ChecksumError is returned when the CRC of a frame does not match the
+// checksum that was sent along with it.
+type ChecksumError struct {
+	// Received is the checksum as found after the frame.
+	Received string
+	// Computed is the checksum calculated over the frame.
+	Computed uint16
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("dsmr: CRC mismatch: %q != %q", e.Received,
+		fmt.Sprintf("%04X", e.Computed))
+}
+
+// Reader reads validated frames from an input stream such as a serial port.
+type Reader struct {
+	br *bufio.Reader
+
+	// MaxFrameSize limits the number of bytes read for a single frame.
+	MaxFrameSize int
+	// Protocol determines if frames without a CRC are accepted.
+	Protocol Protocol
+	// Parser is used to parse the frames.
+	Parser Parser
+	// Skipped counts the garbage bytes that were discarded while looking
+	// for the start of a frame.
+	Skipped int
+}
+
+// NewReader returns a Reader that reads frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		br:           bufio.NewReader(r),
+		MaxFrameSize: DefaultMaxFrameSize,
+	}
+}
+
+// Next reads the next frame from the input, verifies its checksum and parses
+// it. The raw telegram, including the checksum line, is returned as well.
+// Errors from the underlying reader are returned as is, except when they
+// occur in the middle of a frame in which case ErrTruncated is returned.
+func (r *Reader) Next() (f Frame, raw []byte, err error) {
+	if err := r.skipGarbage(); err != nil {
+		return f, nil, err
+	}
+	frame, err := r.readFrame()
+	if err != nil {
+		return f, frame, err
+	}
+	bcrc, err := r.br.ReadBytes('\n')
+	raw = append(frame, bcrc...)
+	if err != nil {
+		if err == io.EOF {
+			err = ErrTruncated
+		}
+		return f, raw, err
+	}
+
+	mcrc := strings.ToUpper(strings.TrimSpace(string(bcrc)))
+	if mcrc == "" {
+		if !r.allowMissingChecksum(frame) {
+			return f, raw, ErrMissingChecksum
+		}
+	} else if crc := crc16.Checksum(frame); mcrc != fmt.Sprintf("%04X", crc) {
+		return f, raw, &ChecksumError{Received: mcrc, Computed: crc}
+	}
+
+	f, err = r.Parser.ParseFrame(string(frame))
+	return f, raw, err
+}
+
+// allowMissingChecksum reports if frame may be accepted without a CRC.
+func (r *Reader) allowMissingChecksum(frame []byte) bool {
+	switch r.Protocol {
+	case ProtocolDSMR3:
+		return true
+	case ProtocolAuto:
+		return !bytes.Contains(frame, []byte("\n1-3:0.2.8("))
+	}
+	return false
+}
+
+// skipGarbage discards all bytes up to the start of the next frame.
+func (r *Reader) skipGarbage() error {
+	for {
+		b, err := r.br.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == '/' {
+			return nil
+		}
+		r.br.ReadByte()
+		r.Skipped++
+	}
+}
+
+// readFrame reads a frame up to and including the '!' end character.
+func (r *Reader) readFrame() ([]byte, error) {
+	max := r.MaxFrameSize
+	if max <= 0 {
+		max = DefaultMaxFrameSize
+	}
+	var buf bytes.Buffer
+	for {
+		line, err := r.br.ReadSlice('!')
+		if buf.Len()+len(line) > max {
+			buf.Write(line[:max-buf.Len()])
+			return buf.Bytes(), ErrFrameTooLarge
+		}
+		buf.Write(line)
+		switch err {
+		case nil:
+			return buf.Bytes(), nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			return buf.Bytes(), ErrTruncated
+		default:
+			return buf.Bytes(), err
+		}
+	}
+}
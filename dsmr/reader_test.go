@@ -0,0 +1,124 @@
+package dsmr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/basvdlei/gotsmart/crc16"
+)
+
+// telegram returns frame with a valid checksum line appended.
+func telegram(frame string) string {
+	return fmt.Sprintf("%s%04X\r\n", frame, crc16.Checksum([]byte(frame)))
+}
+
+func TestReader(t *testing.T) {
+	input := "garbage" + telegram(frame) + telegram(frame)
+	r := NewReader(strings.NewReader(input))
+	for i := 0; i < 2; i++ {
+		f, raw, err := r.Next()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if string(raw) != telegram(frame) {
+			t.Errorf("frame %d: raw does not match %q", i, raw)
+		}
+		if len(f.Objects) != len(frameWant) {
+			t.Errorf("frame %d: size does not match %d != %d", i, len(f.Objects), len(frameWant))
+		}
+	}
+	if r.Skipped != len("garbage") {
+		t.Errorf("skipped does not match %d != %d", r.Skipped, len("garbage"))
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		max   int
+		check func(error) bool
+	}{
+		{
+			name:  "crc mismatch",
+			input: frame + "0000\r\n",
+			check: func(err error) bool {
+				var crcErr *ChecksumError
+				return errors.As(err, &crcErr) && crcErr.Received == "0000"
+			},
+		},
+		{
+			name:  "truncated frame",
+			input: frame[:len(frame)/2],
+			check: func(err error) bool { return err == ErrTruncated },
+		},
+		{
+			name:  "truncated checksum",
+			input: frame + "12",
+			check: func(err error) bool { return err == ErrTruncated },
+		},
+		{
+			name:  "missing crc",
+			input: frame + "\r\n",
+			check: func(err error) bool { return err == ErrMissingChecksum },
+		},
+		{
+			name:  "oversize frame",
+			input: telegram(frame),
+			max:   64,
+			check: func(err error) bool { return err == ErrFrameTooLarge },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.input))
+			if tt.max > 0 {
+				r.MaxFrameSize = tt.max
+			}
+			_, _, err := r.Next()
+			if !tt.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderRecovers(t *testing.T) {
+	input := frame + "0000\r\n" + telegram(frame)
+	r := NewReader(strings.NewReader(input))
+	if _, _, err := r.Next(); err == nil {
+		t.Fatal("expected CRC error")
+	}
+	if _, _, err := r.Next(); err != nil {
+		t.Errorf("expected valid frame after CRC error, got %v", err)
+	}
+}
+
+func TestReaderWithoutChecksum(t *testing.T) {
+	legacy := "/ISk5\\2ME382-1003\r\n\r\n1-0:1.8.1(00264.129*kWh)\r\n!\r\n"
+	tests := []struct {
+		protocol Protocol
+		input    string
+		wantErr  bool
+	}{
+		{protocol: ProtocolAuto, input: legacy},
+		{protocol: ProtocolDSMR3, input: legacy},
+		{protocol: ProtocolDSMR4, input: legacy, wantErr: true},
+		{protocol: ProtocolDSMR3, input: frame + "\r\n"},
+		{protocol: ProtocolDSMR3, input: frame + "0000\r\n", wantErr: true},
+	}
+	for i, tt := range tests {
+		r := NewReader(strings.NewReader(tt.input))
+		r.Protocol = tt.protocol
+		_, _, err := r.Next()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+	}
+}
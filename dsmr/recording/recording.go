@@ -0,0 +1,194 @@
+/*
+Package recording records raw telegram streams and replays them.
+
+A recording is a sequence of records, each a header line with the receive
+time and the size of the telegram followed by the raw telegram and a newline:
+
+	@2026-10-17T18:21:36.123456789+02:00 845
+	/XMX5LGF0000454324731
+	...
+	!2D98
+*/
+package recording
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a single raw telegram with the time it was received.
+type Record struct {
+	Time time.Time
+	Raw  []byte
+}
+
+// Writer appends records to a file that is rotated when it grows beyond
+// MaxSize bytes. Rotated files get the suffix .1 (newest) up to .MaxBackups.
+type Writer struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+
+	// MaxSize is the size in bytes after which the file is rotated, zero
+	// disables rotation.
+	MaxSize int64
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
+}
+
+// NewWriter returns a Writer that appends to the file at path.
+func NewWriter(path string) (*Writer, error) {
+	w := &Writer{path: path}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the current file to the first backup and opens a new one.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.MaxBackups > 0 {
+		for i := w.MaxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Write appends the raw telegram received at t.
+func (w *Writer) Write(t time.Time, raw []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.MaxSize > 0 && w.size > 0 && w.size+int64(len(raw)) > w.MaxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	b := make([]byte, 0, len(raw)+64)
+	b = append(b, fmt.Sprintf("@%s %d\n", t.Format(time.RFC3339Nano), len(raw))...)
+	b = append(b, raw...)
+	b = append(b, '\n')
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	return err
+}
+
+// Close closes the file.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.file.Close()
+}
+
+// Reader reads records from a recording.
+type Reader struct {
+	br *bufio.Reader
+}
+
+// NewReader returns a Reader that reads records from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{br: bufio.NewReader(r)}
+}
+
+// Next returns the next record, or io.EOF at the end of the recording.
+func (r *Reader) Next() (Record, error) {
+	var rec Record
+	header, err := r.br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && header != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return rec, err
+	}
+	fields := strings.Fields(strings.TrimPrefix(header, "@"))
+	if !strings.HasPrefix(header, "@") || len(fields) != 2 {
+		return rec, fmt.Errorf("recording: invalid header %q", header)
+	}
+	rec.Time, err = time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return rec, fmt.Errorf("recording: invalid time: %w", err)
+	}
+	size, err := strconv.Atoi(fields[1])
+	if err != nil || size < 0 {
+		return rec, fmt.Errorf("recording: invalid size %q", fields[1])
+	}
+	rec.Raw = make([]byte, size+1)
+	if _, err := io.ReadFull(r.br, rec.Raw); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return rec, err
+	}
+	// A wrong size would desynchronize all following records.
+	if rec.Raw[size] != '\n' {
+		return rec, fmt.Errorf("recording: record at %s does not end after %d bytes", fields[0], size)
+	}
+	rec.Raw = rec.Raw[:size]
+	return rec, nil
+}
+
+// replayer yields the raw telegrams of a recording with their original
+// spacing divided by speed.
+type replayer struct {
+	r     *Reader
+	speed float64
+	sleep func(time.Duration)
+
+	last time.Time
+	buf  []byte
+}
+
+// Replay returns a reader that yields the raw telegrams of the recording read
+// from r, waiting between telegrams as long as when they were received
+// divided by speed. Telegrams are returned without delay when speed is zero.
+func Replay(r io.Reader, speed float64) io.Reader {
+	return &replayer{r: NewReader(r), speed: speed, sleep: time.Sleep}
+}
+
+func (r *replayer) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		rec, err := r.r.Next()
+		if err != nil {
+			return 0, err
+		}
+		if r.speed > 0 && !r.last.IsZero() {
+			if d := rec.Time.Sub(r.last); d > 0 {
+				r.sleep(time.Duration(float64(d) / r.speed))
+			}
+		}
+		r.last = rec.Time
+		r.buf = rec.Raw
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,111 @@
+package recording
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/basvdlei/gotsmart/dsmr/simulator"
+)
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "p1.rec")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := simulator.New(simulator.Config{Location: time.UTC}, start)
+	var want [][]byte
+	for i := 1; i <= 3; i++ {
+		now := start.Add(time.Duration(i) * 10 * time.Second)
+		raw := m.Telegram(now)
+		want = append(want, raw)
+		if err := w.Write(now, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Garbage and invalid frames are recorded as is.
+	want = append(want, []byte("garbage"))
+	if err := w.Write(start.Add(time.Minute), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var slept []time.Duration
+	replay := Replay(file, 10).(*replayer)
+	replay.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	r := dsmr.NewReader(replay)
+	for i := 0; i < 3; i++ {
+		_, raw, err := r.Next()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(raw, want[i]) {
+			t.Errorf("frame %d: raw does not match %q != %q", i, raw, want[i])
+		}
+	}
+	if _, _, err := r.Next(); err == nil {
+		t.Error("expected error at end of recording")
+	}
+	wantSlept := []time.Duration{time.Second, time.Second, 3 * time.Second}
+	if len(slept) != len(wantSlept) {
+		t.Fatalf("sleeps do not match %v != %v", slept, wantSlept)
+	}
+	for i := range slept {
+		if slept[i] != wantSlept[i] {
+			t.Errorf("sleep %d does not match %v != %v", i, slept[i], wantSlept[i])
+		}
+	}
+}
+
+func TestWriterRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "p1.rec")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.MaxSize = 100
+	w.MaxBackups = 2
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		if err := w.Write(now, bytes.Repeat([]byte{'x'}, 60)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := NewReader(bytes.NewReader(b)).Next()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if len(rec.Raw) != 60 || !rec.Time.Equal(now) {
+			t.Errorf("%s: record does not match %v", name, rec)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, got %v", err)
+	}
+}
+
+func TestReaderCorruptSize(t *testing.T) {
+	r := NewReader(strings.NewReader("@2026-10-16T12:00:00Z 5\nabcdef\n@2026-10-16T12:00:01Z 3\nxyz\n"))
+	if _, err := r.Next(); err == nil {
+		t.Error("expected error for wrong size")
+	}
+}
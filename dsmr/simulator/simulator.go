@@ -0,0 +1,262 @@
+/*
+Package simulator implements a simulated smart meter that produces DSMR 4 and
+5 telegrams.
+
+The meter keeps monotonically increasing tariff registers, switches between
+the low and normal tariff, models a household load with daytime solar
+production and reports a gas reading every GasInterval. Faults like bad CRCs,
+garbage bytes and power failures can be injected.
+*/
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+// Config configures a simulated meter.
+type Config struct {
+	// Version is the DSMR version of the P1 output, like 42 or 50.
+	Version string
+	// Phases is the number of phases, 1 or 3.
+	Phases int
+	// GasInterval is the time between gas readings, 5 minutes for DSMR 5
+	// and an hour for DSMR 4. No gas meter is simulated when zero.
+	GasInterval time.Duration
+	// Location is the time zone of the meter.
+	Location *time.Location
+
+	// BadCRC, Garbage and PowerFailure are the probabilities of a telegram
+	// with an invalid CRC, garbage bytes before a telegram and a power
+	// failure before a telegram.
+	BadCRC       float64
+	Garbage      float64
+	PowerFailure float64
+
+	// Seed initializes the random generator.
+	Seed int64
+}
+
+// Meter is a simulated smart meter.
+type Meter struct {
+	cfg Config
+	rnd *rand.Rand
+	now time.Time
+
+	// Registers in kWh by tariff and m3. The gas reading is the gas
+	// register at the last capture time.
+	delivered  [2]float64
+	received   [2]float64
+	gas        float64
+	gasReading float64
+	gasTime    time.Time
+
+	// Load of the household in kW, excluding solar production.
+	load float64
+
+	powerFailures     int
+	longPowerFailures int
+	failureLog        []dsmr.PowerFailure
+}
+
+// New returns a meter that starts at time start.
+func New(cfg Config, start time.Time) *Meter {
+	if cfg.Version == "" {
+		cfg.Version = "50"
+	}
+	if cfg.Phases != 1 {
+		cfg.Phases = 3
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.Local
+	}
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	m := &Meter{
+		cfg:       cfg,
+		rnd:       rnd,
+		now:       start.In(cfg.Location),
+		delivered: [2]float64{1000 + rnd.Float64()*5000, 1000 + rnd.Float64()*5000},
+		received:  [2]float64{rnd.Float64() * 1000, rnd.Float64() * 1000},
+		gas:       500 + rnd.Float64()*2000,
+		load:      0.4,
+	}
+	m.gasReading = m.gas
+	if cfg.GasInterval > 0 {
+		m.gasTime = start.Truncate(cfg.GasInterval)
+	}
+	return m
+}
+
+// Tariff returns the tariff at t: 1 (low) at night and in the weekend, 2
+// (normal) otherwise.
+func Tariff(t time.Time) int {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday ||
+		t.Hour() < 7 || t.Hour() >= 23 {
+		return 1
+	}
+	return 2
+}
+
+// solar returns the solar production in kW at t, peaking at noon.
+func solar(t time.Time) float64 {
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	if hour < 6 || hour > 20 {
+		return 0
+	}
+	return 3 * math.Sin((hour-6)/14*math.Pi)
+}
+
+// advance moves the meter to time t, accumulating the registers.
+func (m *Meter) advance(t time.Time) {
+	t = t.In(m.cfg.Location)
+	dt := t.Sub(m.now).Hours()
+	if dt < 0 {
+		dt = 0
+	}
+	// Random walk of the household load between 0.1 and 8 kW.
+	m.load += (m.rnd.Float64() - 0.5) * 0.2
+	m.load = math.Max(0.1, math.Min(8, m.load))
+	power := m.load - solar(t)
+
+	tariff := Tariff(m.now) - 1
+	if power > 0 {
+		m.delivered[tariff] += power * dt
+	} else {
+		m.received[tariff] += -power * dt
+	}
+	if m.cfg.GasInterval > 0 {
+		// Gas usage of 0.05 to 0.25 m3 per hour.
+		m.gas += (0.05 + m.rnd.Float64()*0.2) * dt
+	}
+	m.now = t
+}
+
+// powerFailure simulates a power failure that ended at the current time.
+func (m *Meter) powerFailure() {
+	m.powerFailures++
+	// Failures longer than 3 minutes are logged.
+	if m.rnd.Float64() < 0.5 {
+		return
+	}
+	m.longPowerFailures++
+	m.failureLog = append([]dsmr.PowerFailure{{
+		End:      m.now.Truncate(time.Second),
+		Duration: time.Duration(180+m.rnd.Intn(7200)) * time.Second,
+	}}, m.failureLog...)
+	if len(m.failureLog) > 10 {
+		m.failureLog = m.failureLog[:10]
+	}
+}
+
+// Frame returns the frame of the meter at time t.
+func (m *Meter) Frame(t time.Time) dsmr.Frame {
+	m.advance(t)
+	if m.rnd.Float64() < m.cfg.PowerFailure {
+		m.powerFailure()
+	}
+
+	f := dsmr.Frame{
+		Header:      "/XMX5LGF0000454324731",
+		Version:     m.cfg.Version,
+		EquipmentID: "4530303435303034303131373835313137",
+		Timestamp:   m.now.Truncate(time.Second),
+		Location:    m.cfg.Location,
+		Objects:     make(map[string]dsmr.DataObject),
+	}
+	add := func(id string, values ...dsmr.ObjectValue) {
+		last := values[len(values)-1]
+		f.Objects[id] = dsmr.DataObject{ID: id, Value: last.Value, Unit: last.Unit, Values: values}
+	}
+	v := func(value, unit string) dsmr.ObjectValue {
+		return dsmr.ObjectValue{Value: value, Unit: unit}
+	}
+	kwh := func(f float64) dsmr.ObjectValue { return v(fmt.Sprintf("%010.3f", f), "kWh") }
+	kw := func(f float64) dsmr.ObjectValue { return v(fmt.Sprintf("%06.3f", f), "kW") }
+	timestamp := func(t time.Time) dsmr.ObjectValue {
+		flag := "W"
+		if t.IsDST() {
+			flag = "S"
+		}
+		return v(t.Format(dsmr.DateTimeFormat)+flag, "")
+	}
+
+	add("1-0:1.8.1", kwh(m.delivered[0]))
+	add("1-0:1.8.2", kwh(m.delivered[1]))
+	add("1-0:2.8.1", kwh(m.received[0]))
+	add("1-0:2.8.2", kwh(m.received[1]))
+	add("0-0:96.14.0", v(fmt.Sprintf("%04d", Tariff(m.now)), ""))
+
+	power := m.load - solar(m.now)
+	delivered, received := math.Max(power, 0), math.Max(-power, 0)
+	add("1-0:1.7.0", kw(delivered))
+	add("1-0:2.7.0", kw(received))
+
+	add("0-0:96.7.21", v(fmt.Sprintf("%05d", m.powerFailures), ""))
+	add("0-0:96.7.9", v(fmt.Sprintf("%05d", m.longPowerFailures), ""))
+	failureLog := []dsmr.ObjectValue{v(fmt.Sprintf("%d", len(m.failureLog)), ""), v("0-0:96.7.19", "")}
+	for _, pf := range m.failureLog {
+		failureLog = append(failureLog,
+			timestamp(pf.End),
+			v(fmt.Sprintf("%010d", int(pf.Duration.Seconds())), "s"))
+	}
+	add("1-0:99.97.0", failureLog...)
+
+	phases := []string{"32", "52", "72"}[:m.cfg.Phases]
+	current := []string{"31", "51", "71"}
+	activeDelivered := []string{"21", "41", "61"}
+	activeReceived := []string{"22", "42", "62"}
+	for i, ph := range phases {
+		add("1-0:"+ph+".32.0", v("00000", ""))
+		add("1-0:"+ph+".36.0", v("00000", ""))
+		voltage := 230 + (m.rnd.Float64()-0.5)*6
+		add("1-0:"+ph+".7.0", v(fmt.Sprintf("%05.1f", voltage), "V"))
+		share := 1 / float64(m.cfg.Phases)
+		add("1-0:"+current[i]+".7.0", v(fmt.Sprintf("%03.0f", math.Abs(power)*share*1000/voltage), "A"))
+		add("1-0:"+activeDelivered[i]+".7.0", kw(delivered*share))
+		add("1-0:"+activeReceived[i]+".7.0", kw(received*share))
+	}
+	add("0-0:96.13.0", v("", ""))
+
+	if m.cfg.GasInterval > 0 {
+		if capture := m.now.Truncate(m.cfg.GasInterval); capture.After(m.gasTime) {
+			m.gasTime = capture
+			m.gasReading = m.gas
+		}
+		add("0-1:24.1.0", v("003", ""))
+		add("0-1:96.1.0", v("4730303332353631323930333738343134", ""))
+		add("0-1:24.2.1", timestamp(m.gasTime.In(m.cfg.Location)), v(fmt.Sprintf("%09.3f", m.gasReading), "m3"))
+	}
+	return f
+}
+
+// Telegram returns the telegram of the meter at time t, including any
+// injected faults.
+func (m *Meter) Telegram(t time.Time) []byte {
+	b, err := dsmr.Encode(m.Frame(t))
+	if err != nil {
+		// The frame always has a valid header.
+		panic(err)
+	}
+	if m.rnd.Float64() < m.cfg.BadCRC {
+		// Corrupt the last digit of the CRC.
+		i := len(b) - 3
+		if b[i] == '0' {
+			b[i] = '1'
+		} else {
+			b[i] = '0'
+		}
+	}
+	if m.rnd.Float64() < m.cfg.Garbage {
+		garbage := make([]byte, 1+m.rnd.Intn(16))
+		for i := range garbage {
+			// Anything but the start of a frame.
+			garbage[i] = byte(m.rnd.Intn('/'))
+		}
+		b = append(garbage, b...)
+	}
+	return b
+}
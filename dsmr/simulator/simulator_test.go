@@ -0,0 +1,72 @@
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+func TestMeter(t *testing.T) {
+	loc := time.FixedZone("CET", 60*60)
+	start := time.Date(2026, 10, 16, 6, 0, 0, 0, loc)
+	m := New(Config{GasInterval: 5 * time.Minute, Location: loc}, start)
+
+	var last dsmr.Frame
+	var gasUpdates int
+	for i := 1; i <= 24*60; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		r := dsmr.NewReader(bytes.NewReader(m.Telegram(now)))
+		r.Protocol = dsmr.ProtocolDSMR4
+		r.Parser.Location = loc
+		f, _, err := r.Next()
+		if err != nil {
+			t.Fatalf("telegram %d: %v", i, err)
+		}
+		if !f.Timestamp.Equal(now) {
+			t.Fatalf("telegram %d: timestamp does not match %v != %v", i, f.Timestamp, now)
+		}
+		if i > 1 {
+			for _, id := range []string{"1-0:1.8.1", "1-0:1.8.2", "1-0:2.8.1", "1-0:2.8.2", "0-1:24.2.1"} {
+				if value(t, f, id) < value(t, last, id) {
+					t.Errorf("telegram %d: register %s decreased", i, id)
+				}
+			}
+			if f.MBusDevices[1].CaptureTime != last.MBusDevices[1].CaptureTime {
+				gasUpdates++
+			}
+		}
+		last = f
+	}
+	if gasUpdates != 24*12 {
+		t.Errorf("gas updates do not match %d != %d", gasUpdates, 24*12)
+	}
+}
+
+func TestMeterFaults(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := New(Config{BadCRC: 1, Garbage: 1, PowerFailure: 1}, start)
+	r := dsmr.NewReader(bytes.NewReader(m.Telegram(start.Add(time.Second))))
+	_, _, err := r.Next()
+	var crcErr *dsmr.ChecksumError
+	if !errors.As(err, &crcErr) {
+		t.Errorf("expected CRC error, got %v", err)
+	}
+	if r.Skipped == 0 {
+		t.Error("expected garbage before telegram")
+	}
+	if m.powerFailures != 1 {
+		t.Errorf("power failures do not match %d != %d", m.powerFailures, 1)
+	}
+}
+
+func value(t *testing.T, f dsmr.Frame, id string) float64 {
+	v, err := strconv.ParseFloat(f.Objects[id].Value, 64)
+	if err != nil {
+		t.Fatalf("%s: %v", id, err)
+	}
+	return v
+}
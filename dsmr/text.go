@@ -0,0 +1,31 @@
+package dsmr
+
+import (
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+)
+
+// decodeText returns the text of a hex encoded text message. Text that is
+// not valid UTF-8 is decoded as ISO-8859-1, which some grid operators use.
+// Values that are not hex encoded text are returned as is.
+func decodeText(value string) string {
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	text := string(b)
+	if !utf8.Valid(b) {
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	}
+	for _, r := range text {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return value
+		}
+	}
+	return text
+}
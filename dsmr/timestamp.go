@@ -0,0 +1,74 @@
+package dsmr
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	defaultLocationOnce sync.Once
+	defaultLocation     *time.Location
+	defaultLocationErr  error
+)
+
+// timestampRegexp matches values that look like a YYMMDDhhmmss[SW]
+// timestamp.
+var timestampRegexp = regexp.MustCompile("^[0-9]{12}[SW]?$")
+
+// location returns the time zone of the meter. The default location is
+// looked up only once.
+func (p Parser) location() (*time.Location, error) {
+	if p.Location != nil {
+		return p.Location, nil
+	}
+	defaultLocationOnce.Do(func() {
+		defaultLocation, defaultLocationErr = time.LoadLocation("Europe/Amsterdam")
+	})
+	return defaultLocation, defaultLocationErr
+}
+
+// parseTimestamp returns the time of a YYMMDDhhmmssX timestamp in loc, where
+// X is S or W for summer or winter time. It is used to pick the right time
+// in the hour that occurs twice when daylight saving time ends. DSMR 2.2/3.0
+// timestamps without the S/W flag are accepted as well.
+func parseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	var timestamp string
+	var daylight byte
+	switch len(value) {
+	case len(DateTimeFormat):
+		timestamp = value
+	case len(DateTimeFormat) + 1:
+		timestamp = value[:len(value)-1]
+		daylight = value[len(value)-1]
+	default:
+		return time.Time{}, fmt.Errorf("%w %q", errInvalidTimestamp, value)
+	}
+	t, err := time.ParseInLocation(DateTimeFormat, timestamp, loc)
+	if err != nil {
+		return t, fmt.Errorf("%w %q", errInvalidTimestamp, value)
+	}
+
+	var dst bool
+	switch daylight {
+	case 'S':
+		dst = true
+	case 'W':
+		dst = false
+	default:
+		return t, nil
+	}
+	if t.IsDST() == dst {
+		return t, nil
+	}
+	// The same wall clock time with the other offset, only exists in the
+	// repeated hour.
+	for _, d := range []time.Duration{-time.Hour, time.Hour} {
+		c := t.Add(d)
+		if c.IsDST() == dst && c.Format(DateTimeFormat) == timestamp {
+			return c, nil
+		}
+	}
+	return t, nil
+}
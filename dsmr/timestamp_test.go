@@ -0,0 +1,111 @@
+package dsmr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip(err)
+	}
+	brussels, err := time.LoadLocation("Europe/Brussels")
+	if err != nil {
+		t.Skip(err)
+	}
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name  string
+		value string
+		loc   *time.Location
+		want  time.Time
+	}{
+		{
+			name:  "winter time",
+			value: "161215135304W",
+			loc:   amsterdam,
+			want:  time.Date(2016, 12, 15, 12, 53, 4, 0, time.UTC),
+		},
+		{
+			name:  "summer time",
+			value: "161001135304S",
+			loc:   amsterdam,
+			want:  time.Date(2016, 10, 1, 11, 53, 4, 0, time.UTC),
+		},
+		{
+			name:  "before start of summer time",
+			value: "210328015959W",
+			loc:   amsterdam,
+			want:  time.Date(2021, 3, 28, 0, 59, 59, 0, time.UTC),
+		},
+		{
+			name:  "start of summer time",
+			value: "210328030000S",
+			loc:   amsterdam,
+			want:  time.Date(2021, 3, 28, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "repeated hour in summer time",
+			value: "211031023000S",
+			loc:   amsterdam,
+			want:  time.Date(2021, 10, 31, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "repeated hour in winter time",
+			value: "211031023000W",
+			loc:   amsterdam,
+			want:  time.Date(2021, 10, 31, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "after end of summer time",
+			value: "211031030000W",
+			loc:   amsterdam,
+			want:  time.Date(2021, 10, 31, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "other location",
+			value: "211031023000W",
+			loc:   brussels,
+			want:  time.Date(2021, 10, 31, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "other time zone",
+			value: "211031033000S",
+			loc:   helsinki,
+			want:  time.Date(2021, 10, 31, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "without daylight flag",
+			value: "121030140000",
+			loc:   amsterdam,
+			want:  time.Date(2012, 10, 30, 13, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimestamp(tt.value, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("time does not match %v != %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParserLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+1", 60*60)
+	f, err := Parser{Location: loc}.ParseFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2016, 10, 1, 12, 53, 4, 0, time.UTC)
+	if !f.Timestamp.Equal(want) {
+		t.Errorf("timestamp does not match %v != %v", f.Timestamp.UTC(), want)
+	}
+}
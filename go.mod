@@ -3,8 +3,11 @@ module github.com/basvdlei/gotsmart
 go 1.17
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.1
+	github.com/gorilla/websocket v1.5.0
 	github.com/prometheus/client_golang v1.12.2
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	golang.org/x/sys v0.0.0-20220513210249-45d2b4557a2a
 )
 
 require (
@@ -15,6 +18,7 @@ require (
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.34.0 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
-	golang.org/x/sys v0.0.0-20220513210249-45d2b4557a2a // indirect
+	golang.org/x/net v0.0.0-20220225172249-27dd8689420f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
 )
@@ -1,18 +1,22 @@
 package main
 
 import (
-	"bufio"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
+	_ "time/tzdata" // embed the time zone database for minimal containers
 
-	"github.com/basvdlei/gotsmart/crc16"
 	"github.com/basvdlei/gotsmart/dsmr"
 	dsmrprometheus "github.com/basvdlei/gotsmart/dsmr/prometheus"
+	"github.com/basvdlei/gotsmart/dsmr/recording"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tarm/serial"
@@ -20,10 +24,34 @@ import (
 
 const version = "0.0.3"
 
+// output receives every accepted frame along with its JSON representation.
+// Publish must not block the reading of frames.
+type output interface {
+	Publish(f dsmr.Frame, body []byte)
+}
+
 type frameupdate struct {
 	mutex sync.Mutex
 	Frame string
 	Time  time.Time
+
+	// strict drops frames with lines that could not be parsed.
+	strict bool
+	// message keeps the last text message of the frames.
+	message *messageupdate
+	// api keeps the last frame as JSON.
+	api *frameapi
+	// stream pushes the frames to clients.
+	stream *hub
+	// outputs are the outputs all frames are published to.
+	outputs []output
+	// recorder records the raw telegrams when set.
+	recorder *recording.Writer
+	// sleep waits between reconnects, it defaults to time.Sleep.
+	sleep func(time.Duration)
+	// loggedReasons holds the parse error reasons that were logged, each
+	// reason is only logged once and counted afterwards.
+	loggedReasons map[string]bool
 }
 
 func (f *frameupdate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +62,12 @@ func (f *frameupdate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(f.Frame))
 }
 
+func (f *frameupdate) lastUpdate() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.Time
+}
+
 func (f *frameupdate) Update(frame string) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
@@ -41,97 +75,370 @@ func (f *frameupdate) Update(frame string) {
 	f.Time = time.Now()
 }
 
-func (f *frameupdate) Process(br *bufio.Reader, collector *dsmrprometheus.DSMRCollector) {
+// rejectReasons are the reasons for frames dropped because of an error.
+var rejectReasons = map[error]string{
+	dsmr.ErrFrameTooLarge:   "too_large",
+	dsmr.ErrMissingChecksum: "missing_crc",
+	dsmr.ErrDecryption:      "decryption",
+}
+
+// Process reads frames from r until the input fails and returns the error
+// that caused it. Invalid frames are reported and skipped.
+func (f *frameupdate) Process(r *dsmr.Reader, collector *dsmrprometheus.DSMRCollector) error {
+	// The interval is only measured between frames of the same connection,
+	// so outages are not observed as intervals.
+	var lastAccepted time.Time
 	for {
-		if b, err := br.Peek(1); err == nil {
-			if string(b) != "/" {
-				fmt.Printf("Ignoring garbage character: %c\n", b)
-				br.ReadByte()
-				continue
+		skipped := r.Skipped
+		frame, raw, err := r.Next()
+		if n := r.Skipped - skipped; n > 0 {
+			fmt.Printf("Ignored %d garbage characters\n", n)
+			garbageBytesCounter.Add(float64(n))
+		}
+		if len(raw) > 0 {
+			framesReceivedCounter.Inc()
+		}
+		if f.recorder != nil && len(raw) > 0 {
+			if err := f.recorder.Write(time.Now(), raw); err != nil {
+				log.Printf("could not record frame: %v\n", err)
 			}
-		} else {
-			continue
 		}
-		frame, err := br.ReadBytes('!')
-		if err != nil {
+		var crcErr *dsmr.ChecksumError
+		var parseErr *dsmr.ParseError
+		var lineErrs []dsmr.LineError
+		switch {
+		case err == nil:
+		case errors.As(err, &parseErr):
+			lineErrs = parseErr.Errors
+			for _, le := range parseErr.Errors {
+				if !f.loggedReasons[le.Reason] {
+					log.Printf("could not parse frame: %v (further %s errors are only counted)\n", le, le.Reason)
+					if f.loggedReasons == nil {
+						f.loggedReasons = make(map[string]bool)
+					}
+					f.loggedReasons[le.Reason] = true
+				}
+				parseErrorsCounter.WithLabelValues(le.Reason).Inc()
+			}
+			if f.strict {
+				framesRejectedCounter.WithLabelValues("parse").Inc()
+				continue
+			}
+		case errors.As(err, &crcErr):
 			fmt.Printf("Error: %v\n", err)
+			framesRejectedCounter.WithLabelValues("crc").Inc()
 			continue
-		}
-		bcrc, err := br.ReadBytes('\n')
-		if err != nil {
+		case err == dsmr.ErrFrameTooLarge, err == dsmr.ErrMissingChecksum,
+			err == dsmr.ErrDecryption:
+			// Only this frame is invalid, keep reading.
 			fmt.Printf("Error: %v\n", err)
+			framesRejectedCounter.WithLabelValues(rejectReasons[err]).Inc()
 			continue
+		default:
+			return err
 		}
-		// Check CRC
-		mcrc := strings.ToUpper(strings.TrimSpace(string(bcrc)))
-		crc := fmt.Sprintf("%04X", crc16.Checksum(frame))
-		if mcrc != crc {
-			fmt.Printf("CRC mismatch: %q != %q\n", mcrc, crc)
-			continue
+		framesAcceptedCounter.Inc()
+		if !lastAccepted.IsZero() {
+			frameIntervalHistogram.Observe(time.Since(lastAccepted).Seconds())
 		}
-		f.Update(string(frame))
-		dsmrFrame, err := dsmr.ParseFrame(string(frame))
+		lastAccepted = time.Now()
+		f.Update(string(raw))
+		f.message.Update(frame)
+		if b := f.api.Update(frame, raw, lineErrs); b != nil {
+			for _, o := range f.outputs {
+				o.Publish(frame, b)
+			}
+		}
+		collector.Update(frame)
+	}
+}
+
+// Run keeps processing frames from src using readers created by newReader.
+// Whenever the connection fails it is reopened, waiting longer after each
+// consecutive failure.
+func (f *frameupdate) Run(src source, newReader func(io.Reader) *dsmr.Reader, collector *dsmrprometheus.DSMRCollector) {
+	sleep := f.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	backoff := minBackoff
+	for {
+		connected := time.Now()
+		rc, err := src.Open()
 		if err != nil {
-			log.Printf("could not parse frame: %v\n", err)
-			continue
+			log.Printf("could not open %s: %v\n", src, err)
+		} else {
+			log.Printf("reading from %s\n", src)
+			connectedGauge.Set(1)
+			err = f.Process(newReader(countReader{rc}), collector)
+			connectedGauge.Set(0)
+			rc.Close()
+			log.Printf("lost connection to %s: %v\n", src, err)
+			if f.lastUpdate().After(connected) {
+				backoff = minBackoff
+			}
+		}
+		sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
 		}
-		collector.Update(dsmrFrame)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			simulate(os.Args[2:])
+			return
+		case "decode":
+			decode(os.Args[2:])
+			return
+		}
+	}
+
 	var (
-		addrFlag   = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
-		deviceFlag = flag.String("device", "/dev/ttyAMA0", "Serial device to read P1 data from.")
-		baudFlag   = flag.Int("baud", 115200, "Baud rate (speed) to use.")
-		bitsFlag   = flag.Int("bits", 8, "Number of databits.")
-		parityFlag = flag.String("parity", "none", "Parity the use (none/odd/even/mark/space).")
+		addrFlag     = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
+		deviceFlag   = flag.String("device", "/dev/ttyAMA0", "Serial device to read P1 data from.")
+		sourceFlag   = flag.String("source", "", "Read P1 data from a network source like tcp://host:port instead of a serial device.")
+		baudFlag     = flag.Int("baud", 115200, "Baud rate (speed) to use.")
+		bitsFlag     = flag.Int("bits", 8, "Number of databits.")
+		parityFlag   = flag.String("parity", "none", "Parity the use (none/odd/even/mark/space).")
+		keyFlag      = flag.String("key", "", "Hex encoded AES-128 key to decrypt telegrams of encrypted meters (e.g. Luxembourg Smarty).")
+		aadFlag      = flag.String("aad", "3000112233445566778899AABBCCDDEEFF", "Hex encoded additional authenticated data used with -key.")
+		captureFlag  = flag.Bool("capture-timestamps", false, "Use the capture time of gas and other M-Bus readings as sample timestamp.")
+		frameTSFlag  = flag.Bool("frame-timestamps", false, "Use the timestamp of the frame as sample timestamp.")
+		baseUnitFlag = flag.Bool("base-units", false, "Export values in base SI units (joules/watts/volts/amperes/cubic meters).")
+		tzFlag       = flag.String("timezone", "Europe/Amsterdam", "Time zone of the meter.")
+		strictFlag   = flag.Bool("strict", false, "Drop frames with lines that could not be parsed.")
+		protocolFlag = flag.String("protocol", "auto", "DSMR protocol (auto/dsmr4/dsmr3), dsmr3 accepts frames without CRC and defaults to 9600 7E1.")
+		originsFlag  = flag.String("stream-origins", "", "Comma separated origins of other sites allowed to use /api/v1/stream, * allows all.")
+		recordFlag   = flag.String("record", "", "Append all raw telegrams with their receive time to this file.")
+		recordSize   = flag.Int("record-max-size", 10, "Size in MB after which the recording is rotated.")
+		recordKeep   = flag.Int("record-backups", 3, "Number of rotated recordings to keep.")
+		replayFlag   = flag.String("replay", "", "Read telegrams from a recording instead of the meter.")
+		replaySpeed  = flag.Float64("replay-speed", 1, "Speed of the replay relative to the recording, 0 replays as fast as possible.")
+		mqttBroker   = flag.String("mqtt-broker", "", "Publish frames to this MQTT broker like tcp://host:1883 or ssl://host:8883.")
+		mqttClientID = flag.String("mqtt-client-id", "gotsmart", "MQTT client ID.")
+		mqttUsername = flag.String("mqtt-username", "", "MQTT username.")
+		mqttPassword = flag.String("mqtt-password", "", "MQTT password, defaults to the MQTT_PASSWORD environment variable.")
+		mqttTopic    = flag.String("mqtt-topic", "gotsmart", "Prefix of the MQTT topics.")
+		mqttQoS      = flag.Int("mqtt-qos", 0, "QoS of the published MQTT messages (0/1/2).")
+		mqttRetain   = flag.Bool("mqtt-retain", false, "Retain the published MQTT messages.")
+		mqttCA       = flag.String("mqtt-ca-file", "", "CA certificates to verify the MQTT broker.")
+		mqttCert     = flag.String("mqtt-cert-file", "", "Client certificate for the MQTT broker.")
+		mqttKey      = flag.String("mqtt-key-file", "", "Key of the client certificate for the MQTT broker.")
+		mqttInsecure = flag.Bool("mqtt-insecure", false, "Do not verify the certificate of the MQTT broker.")
+		hassFlag     = flag.Bool("mqtt-discovery", false, "Announce the sensors to Home Assistant with MQTT discovery.")
+		hassPrefix   = flag.String("mqtt-discovery-prefix", "homeassistant", "Prefix of the Home Assistant MQTT discovery topics.")
+		influxURL    = flag.String("influx-url", "", "Write frames to InfluxDB at this URL like http://host:8086 or udp://host:8089.")
+		influxDB     = flag.String("influx-database", "gotsmart", "InfluxDB 1.x database.")
+		influxRP     = flag.String("influx-retention-policy", "", "InfluxDB 1.x retention policy.")
+		influxUser   = flag.String("influx-username", "", "InfluxDB 1.x username.")
+		influxPass   = flag.String("influx-password", "", "InfluxDB 1.x password, defaults to the INFLUX_PASSWORD environment variable.")
+		influxOrg    = flag.String("influx-org", "", "InfluxDB 2.x organization.")
+		influxBucket = flag.String("influx-bucket", "", "InfluxDB 2.x bucket, selects the 2.x write API.")
+		influxToken  = flag.String("influx-token", "", "InfluxDB 2.x token, defaults to the INFLUX_TOKEN environment variable.")
+		influxBatch  = flag.Int("influx-batch-size", 100, "Number of points written to InfluxDB at once.")
+		influxFlush  = flag.Duration("influx-flush-interval", 10*time.Second, "Maximum time points are batched before writing them to InfluxDB.")
+		influxSpool  = flag.String("influx-spool", "", "File to keep points in while InfluxDB is unavailable.")
 	)
 	flag.Parse()
 
-	fmt.Printf("GotSmart (%s)\n", version)
-
-	var parity serial.Parity
-	switch *parityFlag {
-	case "none":
-		parity = serial.ParityNone
-	case "odd":
-		parity = serial.ParityOdd
-	case "even":
-		parity = serial.ParityEven
-	case "mark":
-		parity = serial.ParityMark
-	case "space":
-		parity = serial.ParitySpace
-	default:
-		log.Fatal("Invalid parity setting")
-	}
-
-	c := &serial.Config{
-		Name:   *deviceFlag,
-		Baud:   *baudFlag,
-		Size:   byte(*bitsFlag),
-		Parity: parity,
-	}
-	p, err := serial.OpenPort(c)
+	protocol, err := dsmr.ParseProtocol(*protocolFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
+	loc, err := time.LoadLocation(*tzFlag)
+	if err != nil {
+		log.Fatalf("Invalid timezone: %v", err)
+	}
+	if protocol == dsmr.ProtocolDSMR3 {
+		// DSMR 2.2 and 3.0 meters use 9600 baud 7E1.
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["baud"] {
+			*baudFlag = 9600
+		}
+		if !set["bits"] {
+			*bitsFlag = 7
+		}
+		if !set["parity"] {
+			*parityFlag = "even"
+		}
+	}
+
+	fmt.Printf("GotSmart (%s)\n", version)
 
-	br := bufio.NewReader(p)
-	collector := &dsmrprometheus.DSMRCollector{}
+	collector := &dsmrprometheus.DSMRCollector{
+		UseCaptureTimestamps: *captureFlag,
+		UseFrameTimestamps:   *frameTSFlag,
+		UseBaseUnits:         *baseUnitFlag,
+	}
 	prometheus.MustRegister(collector)
-	f := &frameupdate{mutex: sync.Mutex{}}
-	go f.Process(br, collector)
+	var origins []string
+	if *originsFlag != "" {
+		origins = strings.Split(*originsFlag, ",")
+	}
+	f := &frameupdate{
+		mutex:   sync.Mutex{},
+		strict:  *strictFlag,
+		message: &messageupdate{},
+		api:     &frameapi{},
+		stream:  newHub(origins),
+	}
+	f.outputs = append(f.outputs, f.stream)
+
+	if *recordFlag != "" {
+		f.recorder, err = recording.NewWriter(*recordFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.recorder.MaxSize = int64(*recordSize) << 20
+		f.recorder.MaxBackups = *recordKeep
+	}
+
+	if *mqttBroker != "" {
+		if *mqttQoS < 0 || *mqttQoS > 2 {
+			log.Fatal("Invalid MQTT QoS")
+		}
+		if *mqttPassword == "" {
+			*mqttPassword = os.Getenv("MQTT_PASSWORD")
+		}
+		tlsConfig, err := newTLSConfig(*mqttCA, *mqttCert, *mqttKey, *mqttInsecure)
+		if err != nil {
+			log.Fatalf("Invalid MQTT TLS configuration: %v", err)
+		}
+		f.outputs = append(f.outputs, newMQTTOutput(mqttConfig{
+			Broker:   *mqttBroker,
+			ClientID: *mqttClientID,
+			Username: *mqttUsername,
+			Password: *mqttPassword,
+			Topic:    *mqttTopic,
+			QoS:      byte(*mqttQoS),
+			Retain:   *mqttRetain,
+			TLS:      tlsConfig,
+
+			Discovery:       *hassFlag,
+			DiscoveryPrefix: *hassPrefix,
+		}))
+	}
+
+	if *influxURL != "" {
+		if *influxPass == "" {
+			*influxPass = os.Getenv("INFLUX_PASSWORD")
+		}
+		if *influxToken == "" {
+			*influxToken = os.Getenv("INFLUX_TOKEN")
+		}
+		o, err := newInfluxOutput(influxConfig{
+			URL:             *influxURL,
+			Database:        *influxDB,
+			RetentionPolicy: *influxRP,
+			Username:        *influxUser,
+			Password:        *influxPass,
+			Org:             *influxOrg,
+			Bucket:          *influxBucket,
+			Token:           *influxToken,
+			BatchSize:       *influxBatch,
+			FlushInterval:   *influxFlush,
+			Spool:           *influxSpool,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.outputs = append(f.outputs, o)
+	}
+
+	var src source
+	if *replayFlag != "" {
+		src = replaySource{path: *replayFlag, speed: *replaySpeed}
+	} else if *sourceFlag != "" {
+		src, err = parseSource(*sourceFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		var parity serial.Parity
+		switch *parityFlag {
+		case "none":
+			parity = serial.ParityNone
+		case "odd":
+			parity = serial.ParityOdd
+		case "even":
+			parity = serial.ParityEven
+		case "mark":
+			parity = serial.ParityMark
+		case "space":
+			parity = serial.ParitySpace
+		default:
+			log.Fatal("Invalid parity setting")
+		}
+
+		src = serialSource{config: &serial.Config{
+			Name:   *deviceFlag,
+			Baud:   *baudFlag,
+			Size:   byte(*bitsFlag),
+			Parity: parity,
+		}}
+	}
+	prometheus.MustRegister(pipelineCollectors...)
+	var decrypter *dsmr.Decrypter
+	if *keyFlag != "" {
+		key, err := hex.DecodeString(*keyFlag)
+		if err != nil {
+			log.Fatalf("Invalid key: %v", err)
+		}
+		aad, err := hex.DecodeString(*aadFlag)
+		if err != nil {
+			log.Fatalf("Invalid additional authenticated data: %v", err)
+		}
+		decrypter, err = dsmr.NewDecrypter(key, aad)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	newReader := func(rd io.Reader) *dsmr.Reader {
+		if decrypter != nil {
+			rd = decrypter.Reader(rd)
+		}
+		r := dsmr.NewReader(rd)
+		r.Protocol = protocol
+		r.Parser.Location = loc
+		// Always report malformed lines, f.strict decides what to do.
+		r.Parser.Strict = true
+		return r
+	}
+	if *replayFlag != "" {
+		// Replay only once, the metrics stay available afterwards.
+		go func() {
+			rc, err := src.Open()
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer rc.Close()
+			log.Printf("replaying %s\n", src)
+			err = f.Process(newReader(countReader{rc}), collector)
+			log.Printf("finished replaying %s: %v\n", src, err)
+		}()
+	} else {
+		go f.Run(src, newReader, collector)
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/api/v1/message", f.message)
+	mux.Handle("/api/v1/frame", f.api)
 	mux.Handle("/", f)
+	// Streams last as long as the client stays, so only the other handlers
+	// get a timeout.
+	root := http.NewServeMux()
+	root.Handle("/api/v1/stream", f.stream)
+	root.Handle("/", http.TimeoutHandler(mux, 30*time.Second, "timeout"))
 	srv := &http.Server{
-		Addr:         *addrFlag,
-		Handler:      mux,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:              *addrFlag,
+		Handler:           root,
+		ReadHeaderTimeout: 30 * time.Second,
 	}
 	log.Fatal(srv.ListenAndServe())
 }
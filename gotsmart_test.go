@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	dsmrprometheus "github.com/basvdlei/gotsmart/dsmr/prometheus"
+	"github.com/basvdlei/gotsmart/dsmr/simulator"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// frameIntervals returns the number of observed frame intervals.
+func frameIntervals(t *testing.T) uint64 {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(frameIntervalHistogram)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mfs[0].GetMetric()[0].GetHistogram().GetSampleCount()
+}
+
+func TestProcess(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := simulator.New(simulator.Config{Location: time.UTC}, start)
+	var input bytes.Buffer
+	input.WriteString("garbage")
+	input.Write(m.Telegram(start.Add(time.Second)))
+	bad := m.Telegram(start.Add(2 * time.Second))
+	// Corrupt the last digit of the CRC.
+	if i := len(bad) - 3; bad[i] == '0' {
+		bad[i] = '1'
+	} else {
+		bad[i] = '0'
+	}
+	input.Write(bad)
+	input.Write(m.Telegram(start.Add(3 * time.Second)))
+	size := input.Len()
+
+	counters := []prometheus.Collector{
+		framesReceivedCounter,
+		framesAcceptedCounter,
+		framesRejectedCounter.WithLabelValues("crc"),
+		garbageBytesCounter,
+		bytesReadCounter,
+	}
+	before := make([]float64, len(counters))
+	for i, c := range counters {
+		before[i] = testutil.ToFloat64(c)
+	}
+	intervals := frameIntervals(t)
+
+	f := &frameupdate{message: &messageupdate{}, api: &frameapi{}}
+	r := dsmr.NewReader(countReader{&input})
+	if err := f.Process(r, &dsmrprometheus.DSMRCollector{}); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	want := []float64{3, 2, 1, float64(len("garbage")), float64(size)}
+	for i, c := range counters {
+		if got := testutil.ToFloat64(c) - before[i]; got != want[i] {
+			t.Errorf("counter %d does not match %f != %f", i, got, want[i])
+		}
+	}
+	if got := frameIntervals(t) - intervals; got != 1 {
+		t.Errorf("frame intervals do not match %d != %d", got, 1)
+	}
+	if f.Frame == "" {
+		t.Error("last frame not set")
+	}
+}
+
+// fakeSource fails to open until its attempts are used up and then returns
+// the telegrams of the next connection.
+type fakeSource struct {
+	mutex       sync.Mutex
+	failures    int
+	connections [][]byte
+}
+
+func (s *fakeSource) Open() (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failures > 0 || len(s.connections) == 0 {
+		s.failures--
+		return nil, errors.New("no such device")
+	}
+	b := s.connections[0]
+	s.connections = s.connections[1:]
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *fakeSource) String() string {
+	return "fake"
+}
+
+// gaugeReader records the connected gauge when it is read.
+type gaugeReader struct {
+	io.Reader
+	connected *float64
+}
+
+func (r gaugeReader) Read(p []byte) (int, error) {
+	*r.connected = testutil.ToFloat64(connectedGauge)
+	return r.Reader.Read(p)
+}
+
+func TestRun(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := simulator.New(simulator.Config{Location: time.UTC}, start)
+	src := &fakeSource{failures: 3, connections: [][]byte{m.Telegram(start)}}
+	// The delays with the connected gauge at the time of the delay.
+	type delay struct {
+		d         time.Duration
+		connected float64
+	}
+	delays := make(chan delay)
+	f := &frameupdate{
+		message: &messageupdate{},
+		api:     &frameapi{},
+		sleep: func(d time.Duration) {
+			delays <- delay{d, testutil.ToFloat64(connectedGauge)}
+		},
+	}
+	var connected float64
+	newReader := func(r io.Reader) *dsmr.Reader {
+		return dsmr.NewReader(gaugeReader{Reader: r, connected: &connected})
+	}
+	go f.Run(src, newReader, &dsmrprometheus.DSMRCollector{})
+
+	// The delay doubles after each failure and is reset by a connection
+	// that received frames.
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, time.Second, 2 * time.Second}
+	for i, w := range want {
+		got := <-delays
+		if got.d != w {
+			t.Errorf("delay %d does not match %v != %v", i, got.d, w)
+		}
+		if got.connected != 0 {
+			t.Errorf("delay %d: connected gauge does not match %f", i, got.connected)
+		}
+	}
+	if connected != 1 {
+		t.Errorf("connected gauge while reading does not match %f", connected)
+	}
+}
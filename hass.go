@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	dsmrprometheus "github.com/basvdlei/gotsmart/dsmr/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hassDeviceClasses maps units onto the Home Assistant device class.
+var hassDeviceClasses = map[string]string{
+	"kWh": "energy",
+	"kW":  "power",
+	"V":   "voltage",
+	"A":   "current",
+	"m3":  "gas",
+}
+
+// hassUnits maps units onto the units expected by Home Assistant.
+var hassUnits = map[string]string{
+	"m3": "m³",
+}
+
+// hassDevice groups the sensors of a meter in Home Assistant.
+type hassDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	Model       string   `json:"model,omitempty"`
+	SWVersion   string   `json:"sw_version,omitempty"`
+}
+
+// hassSensor is the discovery configuration of a sensor.
+type hassSensor struct {
+	Name              string     `json:"name"`
+	UniqueID          string     `json:"unique_id"`
+	StateTopic        string     `json:"state_topic"`
+	AvailabilityTopic string     `json:"availability_topic"`
+	Unit              string     `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string     `json:"device_class,omitempty"`
+	StateClass        string     `json:"state_class,omitempty"`
+	Device            hassDevice `json:"device"`
+}
+
+// hassConfig is the discovery topic and configuration of a sensor.
+type hassConfig struct {
+	Topic  string
+	Config []byte
+}
+
+// hassConfigs returns the discovery configuration of a sensor for every
+// object of the frame with a metric. The state topics are those published
+// by mqttOutput.
+func hassConfigs(f dsmr.Frame, prefix, topic string) []hassConfig {
+	equipmentID := f.EquipmentID
+	if equipmentID == "" {
+		equipmentID = "unknown"
+	}
+	device := hassDevice{
+		Identifiers: []string{"gotsmart_" + equipmentID},
+		Name:        "Smart meter " + equipmentID,
+		Model:       strings.TrimPrefix(f.Header, "/"),
+		SWVersion:   f.Version,
+	}
+	var configs []hassConfig
+	seen := make(map[string]bool)
+	for _, obj := range f.SortedObjects() {
+		mb, found := dsmrprometheus.Lookup(f, obj.ID)
+		if !found || seen[mb.Name] {
+			continue
+		}
+		seen[mb.Name] = true
+		name := strings.TrimPrefix(mb.Name, "gotsmart_")
+		sensor := hassSensor{
+			Name:              dsmr.Describe(obj.ID),
+			UniqueID:          "gotsmart_" + equipmentID + "_" + name,
+			StateTopic:        topic + "/" + equipmentID + "/" + name,
+			AvailabilityTopic: topic + "/status",
+			Unit:              mb.Unit,
+			DeviceClass:       hassDeviceClasses[mb.Unit],
+			Device:            device,
+		}
+		// Describe names M-Bus objects after the channel, not the reading.
+		if sensor.Name == "" || strings.HasPrefix(sensor.Name, "M-Bus") {
+			sensor.Name = strings.ToUpper(mb.Help[:1]) + mb.Help[1:]
+		}
+		if unit, found := hassUnits[mb.Unit]; found {
+			sensor.Unit = unit
+		}
+		switch mb.ValueType {
+		case prometheus.CounterValue:
+			sensor.StateClass = "total_increasing"
+		case prometheus.GaugeValue:
+			sensor.StateClass = "measurement"
+		}
+		b, err := json.Marshal(sensor)
+		if err != nil {
+			continue
+		}
+		configs = append(configs, hassConfig{
+			Topic:  prefix + "/sensor/gotsmart_" + equipmentID + "/" + name + "/config",
+			Config: b,
+		})
+	}
+	return configs
+}
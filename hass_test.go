@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/basvdlei/gotsmart/dsmr/simulator"
+)
+
+func TestHassConfigs(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := simulator.New(simulator.Config{Location: time.UTC, GasInterval: 5 * time.Minute}, start)
+	// Parse the telegram to get the M-Bus devices like a real frame.
+	f, _, err := dsmr.NewReader(bytes.NewReader(m.Telegram(start))).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := make(map[string]hassSensor)
+	for _, c := range hassConfigs(f, "homeassistant", "gotsmart") {
+		var s hassSensor
+		if err := json.Unmarshal(c.Config, &s); err != nil {
+			t.Fatal(err)
+		}
+		configs[c.Topic] = s
+	}
+	prefix := "homeassistant/sensor/gotsmart_" + f.EquipmentID + "/"
+	tests := []struct {
+		topic       string
+		name        string
+		unit        string
+		deviceClass string
+		stateClass  string
+	}{
+		{"electricity_delivered_to_client_tariff_1_kwh", "Electricity delivered to client (tariff 1)", "kWh", "energy", "total_increasing"},
+		{"electricity_power_delivered_kw", "Actual electricity power delivered (+P)", "kW", "power", "measurement"},
+		{"voltage_l1_v", "Instantaneous voltage L1", "V", "voltage", "measurement"},
+		{"gas_m3", "Actual gas volume delivered", "m³", "gas", "total_increasing"},
+		{"tariff_indicator_electricity", "Tariff indicator electricity", "", "", ""},
+	}
+	for _, tt := range tests {
+		s, found := configs[prefix+tt.topic+"/config"]
+		if !found {
+			t.Errorf("no configuration for %s", tt.topic)
+			continue
+		}
+		if s.Name != tt.name || s.Unit != tt.unit || s.DeviceClass != tt.deviceClass || s.StateClass != tt.stateClass {
+			t.Errorf("configuration of %s does not match %+v", tt.topic, s)
+		}
+		if s.StateTopic != "gotsmart/"+f.EquipmentID+"/"+tt.topic {
+			t.Errorf("state topic of %s does not match %q", tt.topic, s.StateTopic)
+		}
+		if s.Device.Identifiers[0] != "gotsmart_"+f.EquipmentID {
+			t.Errorf("device of %s does not match %v", tt.topic, s.Device.Identifiers)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	dsmrprometheus "github.com/basvdlei/gotsmart/dsmr/prometheus"
+)
+
+const (
+	// influxQueue is the number of frames queued for the writer.
+	influxQueue = 1000
+	// influxRetries is the number of attempts to write a batch before it is
+	// spooled.
+	influxRetries = 3
+	// influxMaxSpool limits the size of the spool file.
+	influxMaxSpool = 64 << 20
+	// influxUDPPayload is the maximum size of a UDP packet.
+	influxUDPPayload = 1400
+)
+
+// influxField is the measurement, phase and field of an object.
+type influxField struct {
+	measurement string
+	phase       string
+	field       string
+}
+
+// influxFields maps objects onto line protocol fields.
+var influxFields = map[string]influxField{
+	"1-0:1.8.1":   {"electricity", "", "delivered_tariff_1_kwh"},
+	"1-0:1.8.2":   {"electricity", "", "delivered_tariff_2_kwh"},
+	"1-0:2.8.1":   {"electricity", "", "received_tariff_1_kwh"},
+	"1-0:2.8.2":   {"electricity", "", "received_tariff_2_kwh"},
+	"0-0:96.14.0": {"electricity", "", "tariff"},
+	"1-0:1.7.0":   {"electricity", "", "power_delivered_kw"},
+	"1-0:2.7.0":   {"electricity", "", "power_received_kw"},
+	"1-0:1.4.0":   {"electricity", "", "average_demand_kw"},
+	"1-0:1.6.0":   {"electricity", "", "maximum_demand_kw"},
+	"0-0:17.0.0":  {"electricity", "", "threshold_kw"},
+	"0-0:96.7.21": {"power_failures", "", "count"},
+	"0-0:96.7.9":  {"power_failures", "", "long_count"},
+	"1-0:32.32.0": {"phase", "L1", "voltage_sags"},
+	"1-0:52.32.0": {"phase", "L2", "voltage_sags"},
+	"1-0:72.32.0": {"phase", "L3", "voltage_sags"},
+	"1-0:32.36.0": {"phase", "L1", "voltage_swells"},
+	"1-0:52.36.0": {"phase", "L2", "voltage_swells"},
+	"1-0:72.36.0": {"phase", "L3", "voltage_swells"},
+	"1-0:32.7.0":  {"phase", "L1", "voltage_v"},
+	"1-0:52.7.0":  {"phase", "L2", "voltage_v"},
+	"1-0:72.7.0":  {"phase", "L3", "voltage_v"},
+	"1-0:31.7.0":  {"phase", "L1", "current_a"},
+	"1-0:51.7.0":  {"phase", "L2", "current_a"},
+	"1-0:71.7.0":  {"phase", "L3", "current_a"},
+	"1-0:21.7.0":  {"phase", "L1", "power_delivered_kw"},
+	"1-0:41.7.0":  {"phase", "L2", "power_delivered_kw"},
+	"1-0:61.7.0":  {"phase", "L3", "power_delivered_kw"},
+	"1-0:22.7.0":  {"phase", "L1", "power_received_kw"},
+	"1-0:42.7.0":  {"phase", "L2", "power_received_kw"},
+	"1-0:62.7.0":  {"phase", "L3", "power_received_kw"},
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ")
+	influxTagEscaper         = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
+)
+
+// influxLines returns the frame in line protocol with a point per
+// measurement and phase. Points get the timestamp of the frame, or t for
+// meters that do not send one. Values are converted into the unit of the
+// specification. M-Bus devices get a measurement named after
+// their type, like gas, with their reading as field named after the unit.
+func influxLines(f dsmr.Frame, t time.Time) []string {
+	if !f.Timestamp.IsZero() {
+		t = f.Timestamp
+	}
+	type key struct{ measurement, phase, channel string }
+	points := make(map[key]map[string]float64)
+	add := func(k key, field string, value float64) {
+		if points[k] == nil {
+			points[k] = make(map[string]float64)
+		}
+		points[k][field] = value
+	}
+	for id, obj := range f.Objects {
+		field, found := influxFields[id]
+		if !found {
+			continue
+		}
+		value, err := strconv.ParseFloat(obj.Value, 64)
+		if err != nil {
+			continue
+		}
+		// Fields are named after the unit of the specification, so convert
+		// units like W or Wh and skip values in other units.
+		if mb, found := dsmrprometheus.Lookup(f, id); found {
+			if value, found = mb.Convert(value, obj.Unit); !found {
+				continue
+			}
+		} else if obj.Unit != "" {
+			continue
+		}
+		add(key{measurement: field.measurement, phase: field.phase}, field.field, value)
+	}
+	for _, d := range f.MBusDevices {
+		if d.HasReading() {
+			k := key{measurement: d.DeviceTypeName(), channel: strconv.Itoa(d.Channel)}
+			add(k, strings.ToLower(d.Unit), d.Value)
+		}
+	}
+
+	var lines []string
+	for k, fields := range points {
+		var sb strings.Builder
+		sb.WriteString(influxMeasurementEscaper.Replace(k.measurement))
+		// Tags are sorted by key as recommended.
+		if k.channel != "" {
+			sb.WriteString(",channel=" + k.channel)
+		}
+		if f.EquipmentID != "" {
+			sb.WriteString(",equipment_id=" + influxTagEscaper.Replace(f.EquipmentID))
+		}
+		if k.phase != "" {
+			sb.WriteString(",phase=" + k.phase)
+		}
+		if f.Version != "" {
+			sb.WriteString(",version=" + influxTagEscaper.Replace(f.Version))
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+			sb.WriteString(sep + name + "=" + strconv.FormatFloat(fields[name], 'f', -1, 64))
+		}
+		sb.WriteString(" " + strconv.FormatInt(t.UnixNano(), 10))
+		lines = append(lines, sb.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// influxConfig configures the InfluxDB output.
+type influxConfig struct {
+	// URL is the address of the server like http://host:8086 or
+	// udp://host:8089.
+	URL string
+	// Database, RetentionPolicy, Username and Password are used for the
+	// InfluxDB 1.x write API.
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+	// Org, Bucket and Token are used for the InfluxDB 2.x write API, which
+	// is selected by setting a Bucket.
+	Org    string
+	Bucket string
+	Token  string
+
+	// BatchSize is the number of points written at once, unless
+	// FlushInterval passes first.
+	BatchSize     int
+	FlushInterval time.Duration
+	// Spool is the file that keeps points that could not be written.
+	Spool string
+}
+
+// influxOutput writes frames to InfluxDB in batches. Batches that can not be
+// written after retrying are appended to the spool file, which is written
+// once the server accepts points again.
+type influxOutput struct {
+	cfg    influxConfig
+	client *http.Client
+	frames chan []string
+
+	// retryDelay is the delay before the first retry, doubling after each
+	// attempt.
+	retryDelay time.Duration
+}
+
+// newInfluxOutput returns the output and starts writing in the background.
+func newInfluxOutput(cfg influxConfig) (*influxOutput, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "udp":
+	default:
+		return nil, fmt.Errorf("unsupported InfluxDB URL %q", cfg.URL)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	o := &influxOutput{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		frames:     make(chan []string, influxQueue),
+		retryDelay: minBackoff,
+	}
+	go o.run()
+	return o, nil
+}
+
+// Publish queues the points of the frame, dropping them when the queue is
+// full.
+func (o *influxOutput) Publish(f dsmr.Frame, body []byte) {
+	select {
+	case o.frames <- influxLines(f, time.Now()):
+	default:
+		log.Printf("dropping frame, InfluxDB output is too slow\n")
+	}
+}
+
+// run batches the queued points and writes them.
+func (o *influxOutput) run() {
+	var batch []string
+	var ticker <-chan time.Time
+	if o.cfg.FlushInterval > 0 {
+		t := time.NewTicker(o.cfg.FlushInterval)
+		defer t.Stop()
+		ticker = t.C
+	}
+	for {
+		select {
+		case lines := <-o.frames:
+			batch = append(batch, lines...)
+			if len(batch) < o.cfg.BatchSize {
+				continue
+			}
+		case <-ticker:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		o.flush(batch)
+		batch = nil
+	}
+}
+
+// flush writes the batch, or spools it when the server is unavailable.
+// Spooled points are written first once the server is available again.
+func (o *influxOutput) flush(batch []string) {
+	body := []byte(strings.Join(batch, "\n") + "\n")
+	if err := o.writeRetry(body); err != nil {
+		log.Printf("could not write to InfluxDB: %v\n", err)
+		if _, permanent := err.(permanentError); !permanent {
+			o.spool(body)
+		}
+		return
+	}
+	o.drainSpool()
+}
+
+// writeRetry writes body, retrying temporary errors.
+func (o *influxOutput) writeRetry(body []byte) error {
+	delay := o.retryDelay
+	var err error
+	for i := 0; i < influxRetries; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = o.write(body); err == nil {
+			return nil
+		}
+		if _, permanent := err.(permanentError); permanent {
+			return err
+		}
+	}
+	return err
+}
+
+// permanentError is an error for which retrying will not help, like points
+// rejected by the server.
+type permanentError struct {
+	error
+}
+
+// write writes points in line protocol to the server.
+func (o *influxOutput) write(body []byte) error {
+	u, err := url.Parse(o.cfg.URL)
+	if err != nil {
+		return permanentError{err}
+	}
+	if u.Scheme == "udp" {
+		return o.writeUDP(u.Host, body)
+	}
+
+	q := url.Values{"precision": {"ns"}}
+	var req *http.Request
+	if o.cfg.Bucket != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+		q.Set("org", o.cfg.Org)
+		q.Set("bucket", o.cfg.Bucket)
+		u.RawQuery = q.Encode()
+		if req, err = http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body)); err != nil {
+			return permanentError{err}
+		}
+		if o.cfg.Token != "" {
+			req.Header.Set("Authorization", "Token "+o.cfg.Token)
+		}
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+		q.Set("db", o.cfg.Database)
+		if o.cfg.RetentionPolicy != "" {
+			q.Set("rp", o.cfg.RetentionPolicy)
+		}
+		u.RawQuery = q.Encode()
+		if req, err = http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body)); err != nil {
+			return permanentError{err}
+		}
+		if o.cfg.Username != "" {
+			req.SetBasicAuth(o.cfg.Username, o.cfg.Password)
+		}
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	default:
+		return permanentError{fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))}
+	}
+}
+
+// writeUDP sends the points in packets of at most influxUDPPayload bytes.
+func (o *influxOutput) writeUDP(addr string, body []byte) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var packet []byte
+	for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+		if len(packet) > 0 && len(packet)+len(line) > influxUDPPayload {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err = conn.Write(packet)
+	}
+	return err
+}
+
+// spool appends body to the spool file.
+func (o *influxOutput) spool(body []byte) {
+	if o.cfg.Spool == "" {
+		return
+	}
+	if info, err := os.Stat(o.cfg.Spool); err == nil && info.Size()+int64(len(body)) > influxMaxSpool {
+		log.Printf("dropping points, spool %s is full\n", o.cfg.Spool)
+		return
+	}
+	file, err := os.OpenFile(o.cfg.Spool, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("could not spool points: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(body); err != nil {
+		log.Printf("could not spool points: %v\n", err)
+	}
+}
+
+// drainSpool writes the spooled points in batches and removes the spool file
+// when all were written. When writing fails halfway the spool is kept as a
+// whole, which is fine as InfluxDB overwrites identical points.
+func (o *influxOutput) drainSpool() {
+	if o.cfg.Spool == "" {
+		return
+	}
+	file, err := os.Open(o.cfg.Spool)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	log.Printf("writing spooled points from %s\n", o.cfg.Spool)
+	var batch []string
+	write := func() error {
+		err := o.write([]byte(strings.Join(batch, "\n") + "\n"))
+		if _, permanent := err.(permanentError); permanent {
+			log.Printf("dropping spooled points: %v\n", err)
+			err = nil
+		}
+		batch = batch[:0]
+		return err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		batch = append(batch, scanner.Text())
+		if len(batch) >= 5000 {
+			if err := write(); err != nil {
+				log.Printf("could not write spooled points: %v\n", err)
+				return
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// Keep the spool, the points that were not read would be lost.
+		log.Printf("could not read spooled points: %v\n", err)
+		return
+	}
+	if len(batch) > 0 {
+		if err := write(); err != nil {
+			log.Printf("could not write spooled points: %v\n", err)
+			return
+		}
+	}
+	os.Remove(o.cfg.Spool)
+}
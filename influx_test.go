@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+const influxFrame = "/ISk5\\2MT382-1000\r\n\r\n" +
+	"1-3:0.2.8(50)\r\n" +
+	"0-0:1.0.0(261016120000S)\r\n" +
+	"0-0:96.1.1(4B38)\r\n" +
+	"1-0:1.8.1(000123.456*kWh)\r\n" +
+	"1-0:1.7.0(01.193*kW)\r\n" +
+	"1-0:32.7.0(230.1*V)\r\n" +
+	"1-0:52.7.0(229.9*V)\r\n" +
+	"0-1:24.1.0(003)\r\n" +
+	"0-1:24.2.1(261016115500S)(00012.345*m3)\r\n" +
+	"!\r\n"
+
+func parseInfluxFrame(t *testing.T) dsmr.Frame {
+	f, err := dsmr.Parser{Location: time.UTC, Strict: true}.ParseFrame(influxFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestInfluxLines(t *testing.T) {
+	got := influxLines(parseInfluxFrame(t), time.Now())
+	want := []string{
+		"electricity,equipment_id=4B38,version=50 delivered_tariff_1_kwh=123.456,power_delivered_kw=1.193 1792152000000000000",
+		"gas,channel=1,equipment_id=4B38,version=50 m3=12.345 1792152000000000000",
+		"phase,equipment_id=4B38,phase=L1,version=50 voltage_v=230.1 1792152000000000000",
+		"phase,equipment_id=4B38,phase=L2,version=50 voltage_v=229.9 1792152000000000000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lines do not match\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInfluxLinesUnits(t *testing.T) {
+	f, err := dsmr.Parser{Location: time.UTC}.ParseFrame("/ISk5\\2MT382-1000\r\n\r\n" +
+		"0-0:1.0.0(261016120000S)\r\n" +
+		"1-0:1.8.1(123456*Wh)\r\n" +
+		"1-0:1.7.0(01193*W)\r\n" +
+		"1-0:32.7.0(230.1*A)\r\n" +
+		"!\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := influxLines(f, time.Now())
+	// Voltage in the wrong unit is dropped.
+	want := []string{
+		"electricity delivered_tariff_1_kwh=123.456,power_delivered_kw=1.193 1792152000000000000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lines do not match\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInfluxOutputSpool(t *testing.T) {
+	var mutex sync.Mutex
+	available := false
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "energy" ||
+			r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("unexpected request %s %v", r.URL, r.Header)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		received = append(received, strings.Split(strings.TrimSpace(string(b)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	spool := filepath.Join(t.TempDir(), "influx.spool")
+	o := &influxOutput{
+		cfg:        influxConfig{URL: srv.URL, Org: "home", Bucket: "energy", Token: "secret", Spool: spool},
+		client:     srv.Client(),
+		retryDelay: time.Millisecond,
+	}
+	f := parseInfluxFrame(t)
+	o.flush(influxLines(f, time.Now())[:1])
+	if _, err := os.Stat(spool); err != nil {
+		t.Fatalf("expected spooled points: %v", err)
+	}
+
+	mutex.Lock()
+	available = true
+	mutex.Unlock()
+	o.flush(influxLines(f, time.Now())[1:2])
+	if len(received) != 2 {
+		t.Fatalf("expected the new and the spooled point, got %q", received)
+	}
+	if !strings.HasPrefix(received[0], "gas,") || !strings.HasPrefix(received[1], "electricity,") {
+		t.Errorf("points do not match %q", received)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("expected spool to be removed: %v", err)
+	}
+}
+
+func TestInfluxOutputSpoolReadError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	spool := filepath.Join(t.TempDir(), "influx.spool")
+	// A line longer than the scanner buffer stops the read halfway.
+	long := "electricity " + strings.Repeat("x", 128<<10) + "=1"
+	if err := os.WriteFile(spool, []byte("gas m3=1\n"+long+"\ngas m3=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	o := &influxOutput{
+		cfg:    influxConfig{URL: srv.URL, Database: "gotsmart", Spool: spool},
+		client: srv.Client(),
+	}
+	o.drainSpool()
+	if _, err := os.Stat(spool); err != nil {
+		t.Errorf("expected spool to be kept: %v", err)
+	}
+}
+
+func TestInfluxOutputUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	o := &influxOutput{cfg: influxConfig{URL: "udp://" + conn.LocalAddr().String()}}
+	lines := influxLines(parseInfluxFrame(t), time.Now())
+	o.flush(lines)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, influxUDPPayload)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(lines, "\n") + "\n"; string(b[:n]) != want {
+		t.Errorf("packet does not match %q != %q", b[:n], want)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+// messageupdate keeps the last text message sent by the grid operator.
+type messageupdate struct {
+	mutex   sync.Mutex
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+	Changed time.Time `json:"changed"`
+}
+
+func (m *messageupdate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+func (m *messageupdate) Update(f dsmr.Frame) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if f.TextMessageCode == m.Code && f.TextMessage == m.Message && !m.Changed.IsZero() {
+		return
+	}
+	m.Code = f.TextMessageCode
+	m.Message = f.TextMessage
+	m.Changed = time.Now()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+)
+
+func TestMessageUpdate(t *testing.T) {
+	type message struct {
+		Code    string    `json:"code"`
+		Message string    `json:"message"`
+		Changed time.Time `json:"changed"`
+	}
+	m := &messageupdate{}
+	get := func() message {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/message", nil))
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content type does not match %q", ct)
+		}
+		var got message
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	m.Update(dsmr.Frame{TextMessageCode: "01", TextMessage: "Onderhoud"})
+	first := get()
+	if first.Code != "01" || first.Message != "Onderhoud" || first.Changed.IsZero() {
+		t.Fatalf("message does not match %+v", first)
+	}
+
+	// The same message does not move the change time.
+	time.Sleep(10 * time.Millisecond)
+	m.Update(dsmr.Frame{TextMessageCode: "01", TextMessage: "Onderhoud"})
+	if got := get(); !got.Changed.Equal(first.Changed) {
+		t.Errorf("changed time moved %v != %v", got.Changed, first.Changed)
+	}
+
+	// Another code or message does.
+	last := first
+	for _, f := range []dsmr.Frame{
+		{TextMessageCode: "02", TextMessage: "Onderhoud"},
+		{TextMessageCode: "02", TextMessage: ""},
+	} {
+		time.Sleep(10 * time.Millisecond)
+		m.Update(f)
+		got := get()
+		if got.Code != f.TextMessageCode || got.Message != f.TextMessage || !got.Changed.After(last.Changed) {
+			t.Errorf("message does not match %+v", got)
+		}
+		last = got
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var parseErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gotsmart_parse_errors_total",
+	Help: "number of lines in frames that could not be parsed",
+}, []string{"reason"})
+
+var (
+	framesReceivedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gotsmart_frames_received_total",
+		Help: "number of frames read from the source, valid or not",
+	})
+	framesAcceptedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gotsmart_frames_accepted_total",
+		Help: "number of frames used to update the metrics and outputs",
+	})
+	framesRejectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gotsmart_frames_rejected_total",
+		Help: "number of frames that were dropped by reason (crc/missing_crc/too_large/decryption/parse)",
+	}, []string{"reason"})
+	garbageBytesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gotsmart_garbage_bytes_total",
+		Help: "number of bytes skipped while looking for the start of a frame",
+	})
+	bytesReadCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gotsmart_bytes_read_total",
+		Help: "number of bytes read from the source",
+	})
+	frameIntervalHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gotsmart_frame_interval_seconds",
+		Help:    "time between accepted frames",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 15, 30, 60, 120, 300},
+	})
+)
+
+// pipelineCollectors are the metrics about reading frames.
+var pipelineCollectors = []prometheus.Collector{
+	connectedGauge,
+	parseErrorsCounter,
+	framesReceivedCounter,
+	framesAcceptedCounter,
+	framesRejectedCounter,
+	garbageBytesCounter,
+	bytesReadCounter,
+	frameIntervalHistogram,
+}
+
+// countReader counts the bytes read from the source.
+type countReader struct {
+	io.Reader
+}
+
+func (r countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	bytesReadCounter.Add(float64(n))
+	return n, err
+}
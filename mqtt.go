@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	dsmrprometheus "github.com/basvdlei/gotsmart/dsmr/prometheus"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// mqttBuffer is the number of frames kept while the broker is not
+	// reachable. The oldest frames are dropped first.
+	mqttBuffer = 300
+	// mqttTimeout is the time to wait for the broker to accept a message.
+	mqttTimeout = 10 * time.Second
+)
+
+// mqttConfig configures the MQTT output.
+type mqttConfig struct {
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// Topic is the prefix of all topics.
+	Topic  string
+	QoS    byte
+	Retain bool
+	TLS    *tls.Config
+	// Discovery announces the sensors to Home Assistant on topics starting
+	// with DiscoveryPrefix.
+	Discovery       bool
+	DiscoveryPrefix string
+}
+
+// newTLSConfig returns the TLS configuration for a broker. The CA file and
+// client certificate are optional.
+func newTLSConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// mqttFrame is a frame with its JSON representation.
+type mqttFrame struct {
+	frame dsmr.Frame
+	body  []byte
+}
+
+// mqttOutput publishes frames to an MQTT broker. Every frame is published as
+// JSON on <topic>/<equipment id>/frame and every object with a metric on
+// <topic>/<equipment id>/<metric name>. The status of gotsmart is published
+// on <topic>/status as online or, by the broker, offline.
+type mqttOutput struct {
+	cfg    mqttConfig
+	client mqtt.Client
+	frames chan mqttFrame
+
+	// announced are the Home Assistant discovery topics published since
+	// the last connect.
+	mutex     sync.Mutex
+	announced map[string]bool
+}
+
+// newMQTTOutput connects to the broker in the background and returns the
+// output.
+func newMQTTOutput(cfg mqttConfig) *mqttOutput {
+	o := &mqttOutput{
+		cfg:       cfg,
+		frames:    make(chan mqttFrame, mqttBuffer),
+		announced: make(map[string]bool),
+	}
+	status := cfg.Topic + "/status"
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetTLSConfig(cfg.TLS).
+		SetWill(status, "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(minBackoff).
+		SetMaxReconnectInterval(maxBackoff).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			log.Printf("connected to %s\n", cfg.Broker)
+			c.Publish(status, 1, true, "online")
+			// Announce again in case the broker lost the retained
+			// configurations.
+			o.mutex.Lock()
+			o.announced = make(map[string]bool)
+			o.mutex.Unlock()
+		}).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			log.Printf("lost connection to %s: %v\n", cfg.Broker, err)
+		})
+	o.client = mqtt.NewClient(opts)
+	o.client.Connect()
+	go o.run()
+	return o
+}
+
+// Publish queues the frame for publishing without blocking.
+func (o *mqttOutput) Publish(f dsmr.Frame, body []byte) {
+	for {
+		select {
+		case o.frames <- mqttFrame{frame: f, body: body}:
+			return
+		default:
+		}
+		// Make room by dropping the oldest frame.
+		select {
+		case <-o.frames:
+		default:
+		}
+	}
+}
+
+// run publishes the queued frames whenever the broker is connected.
+func (o *mqttOutput) run() {
+	for mf := range o.frames {
+		for !o.client.IsConnectionOpen() {
+			time.Sleep(100 * time.Millisecond)
+		}
+		o.publish(mf)
+	}
+}
+
+func (o *mqttOutput) publish(mf mqttFrame) {
+	equipmentID := mf.frame.EquipmentID
+	if equipmentID == "" {
+		equipmentID = "unknown"
+	}
+	prefix := o.cfg.Topic + "/" + equipmentID + "/"
+	var tokens []mqtt.Token
+	if o.cfg.Discovery {
+		tokens = o.announce(mf.frame)
+	}
+	tokens = append(tokens, o.client.Publish(prefix+"frame", o.cfg.QoS, o.cfg.Retain, mf.body))
+	for _, obj := range mf.frame.Objects {
+		mb, found := dsmrprometheus.Lookup(mf.frame, obj.ID)
+		if !found {
+			continue
+		}
+		value, err := strconv.ParseFloat(obj.Value, 64)
+		if err != nil {
+			continue
+		}
+		if value, found = mb.Convert(value, obj.Unit); !found {
+			continue
+		}
+		topic := prefix + strings.TrimPrefix(mb.Name, "gotsmart_")
+		payload := strconv.FormatFloat(value, 'f', -1, 64)
+		tokens = append(tokens, o.client.Publish(topic, o.cfg.QoS, o.cfg.Retain, payload))
+	}
+	for _, t := range tokens {
+		if !t.WaitTimeout(mqttTimeout) {
+			log.Printf("could not publish to %s: timeout\n", o.cfg.Broker)
+			return
+		}
+		if err := t.Error(); err != nil {
+			log.Printf("could not publish to %s: %v\n", o.cfg.Broker, err)
+			return
+		}
+	}
+}
+
+// announce publishes the Home Assistant discovery configuration of the
+// sensors of the frame that were not announced yet.
+func (o *mqttOutput) announce(f dsmr.Frame) []mqtt.Token {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var tokens []mqtt.Token
+	for _, c := range hassConfigs(f, o.cfg.DiscoveryPrefix, o.cfg.Topic) {
+		if o.announced[c.Topic] {
+			continue
+		}
+		o.announced[c.Topic] = true
+		tokens = append(tokens, o.client.Publish(c.Topic, 1, true, c.Config))
+	}
+	return tokens
+}
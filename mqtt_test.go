@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr/simulator"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// fakeBroker accepts MQTT connections on l and sends the CONNECT and PUBLISH
+// packets it receives to ch.
+func fakeBroker(t *testing.T, l net.Listener, ch chan<- packets.ControlPacket) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				cp, err := packets.ReadPacket(conn)
+				if err != nil {
+					return
+				}
+				var reply packets.ControlPacket
+				switch p := cp.(type) {
+				case *packets.ConnectPacket:
+					reply = packets.NewControlPacket(packets.Connack)
+				case *packets.PublishPacket:
+					if p.Qos > 0 {
+						ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+						ack.MessageID = p.MessageID
+						reply = ack
+					}
+				case *packets.PingreqPacket:
+					reply = packets.NewControlPacket(packets.Pingresp)
+				}
+				if reply != nil {
+					if err := reply.Write(conn); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+				ch <- cp
+			}
+		}()
+	}
+}
+
+func TestMQTTOutput(t *testing.T) {
+	// Reserve an address for the broker, which is started after the first
+	// frame is published to test buffering.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	o := newMQTTOutput(mqttConfig{
+		Broker:   "tcp://" + addr,
+		ClientID: "test",
+		Topic:    "gotsmart",
+		QoS:      1,
+	})
+	defer o.client.Disconnect(0)
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	f := simulator.New(simulator.Config{Location: time.UTC}, start).Frame(start)
+	o.Publish(f, []byte(`{}`))
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ch := make(chan packets.ControlPacket, 100)
+	go fakeBroker(t, l, ch)
+
+	prefix := "gotsmart/" + f.EquipmentID + "/"
+	want := map[string]string{
+		"gotsmart/status":                       "online",
+		prefix + "frame":                        "{}",
+		prefix + "tariff_indicator_electricity": "2",
+	}
+	timeout := time.After(10 * time.Second)
+	for len(want) > 0 {
+		select {
+		case cp := <-ch:
+			switch p := cp.(type) {
+			case *packets.ConnectPacket:
+				if p.WillTopic != "gotsmart/status" || string(p.WillMessage) != "offline" || !p.WillRetain {
+					t.Errorf("last will does not match %q %q", p.WillTopic, p.WillMessage)
+				}
+			case *packets.PublishPacket:
+				if payload, found := want[p.TopicName]; found {
+					if string(p.Payload) != payload {
+						t.Errorf("payload of %s does not match %q != %q", p.TopicName, p.Payload, payload)
+					}
+					delete(want, p.TopicName)
+				}
+			}
+		case <-timeout:
+			t.Fatalf("topics not published: %v", want)
+		}
+	}
+}
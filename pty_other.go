@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY is only supported on Linux.
+func openPTY() (*os.File, string, error) {
+	return nil, "", errors.New("pty output is only supported on linux")
+}
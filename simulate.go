@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr/simulator"
+)
+
+// simulate runs the simulate command which writes the telegrams of a
+// simulated meter to stdout, a pty or TCP clients.
+func simulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var (
+		outputFlag       = fs.String("output", "stdout", "Where to write telegrams to (stdout/pty/tcp://host:port to listen on).")
+		intervalFlag     = fs.Duration("interval", time.Second, "Time between telegrams, 1s for DSMR 5 and 10s for DSMR 4.")
+		versionFlag      = fs.String("version", "50", "DSMR version of the P1 output (42/50).")
+		phasesFlag       = fs.Int("phases", 3, "Number of phases (1/3).")
+		gasFlag          = fs.Duration("gas-interval", 5*time.Minute, "Time between gas readings, 0 disables the gas meter.")
+		tzFlag           = fs.String("timezone", "Europe/Amsterdam", "Time zone of the meter.")
+		badCRCFlag       = fs.Float64("bad-crc", 0, "Probability of a telegram with an invalid CRC.")
+		garbageFlag      = fs.Float64("garbage", 0, "Probability of garbage bytes before a telegram.")
+		powerFailureFlag = fs.Float64("power-failure", 0, "Probability of a power failure before a telegram.")
+		seedFlag         = fs.Int64("seed", 0, "Seed of the random generator, 0 picks a random seed.")
+	)
+	fs.Parse(args)
+
+	loc, err := time.LoadLocation(*tzFlag)
+	if err != nil {
+		log.Fatalf("Invalid timezone: %v", err)
+	}
+	seed := *seedFlag
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	w, err := openOutput(*outputFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m := simulator.New(simulator.Config{
+		Version:      *versionFlag,
+		Phases:       *phasesFlag,
+		GasInterval:  *gasFlag,
+		Location:     loc,
+		BadCRC:       *badCRCFlag,
+		Garbage:      *garbageFlag,
+		PowerFailure: *powerFailureFlag,
+		Seed:         seed,
+	}, time.Now())
+	ticker := time.NewTicker(*intervalFlag)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if _, err := w.Write(m.Telegram(now)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// openOutput returns the writer for the output of the simulator.
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case "stdout":
+		return os.Stdout, nil
+	case "pty":
+		master, name, err := openPTY()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Writing telegrams to %s\n", name)
+		return master, nil
+	}
+	u, err := url.Parse(output)
+	if err != nil || u.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported output %q", output)
+	}
+	l, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Writing telegrams to clients of tcp://%s\n", l.Addr())
+	b := &broadcaster{conns: make(map[net.Conn]bool)}
+	go b.accept(l)
+	return b, nil
+}
+
+// broadcaster writes to all connected TCP clients.
+type broadcaster struct {
+	mutex sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// accept adds the clients of l until l is closed. After other errors it
+// waits longer each time, like net/http does.
+func (b *broadcaster) accept(l net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			log.Printf("could not accept connection: %v, retrying in %v\n", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		b.mutex.Lock()
+		b.conns[conn] = true
+		b.mutex.Unlock()
+	}
+}
+
+// Write writes p to all clients and drops the clients that fail.
+func (b *broadcaster) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for conn := range b.conns {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(p); err != nil {
+			conn.Close()
+			delete(b.conns, conn)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBroadcasterAccept(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broadcaster{conns: make(map[net.Conn]bool)}
+	done := make(chan struct{})
+	go func() {
+		b.accept(l)
+		close(done)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 100; i++ {
+		b.mutex.Lock()
+		n := len(b.conns)
+		b.mutex.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.Write([]byte("/telegram\r\n"))
+	buf := make([]byte, 11)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "/telegram\r\n" {
+		t.Errorf("telegram does not match %q: %v", buf, err)
+	}
+
+	// Closing the listener stops accepting.
+	l.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept did not return after closing the listener")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr/recording"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tarm/serial"
+)
+
+const (
+	// minBackoff and maxBackoff bound the delay between reconnects.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+	// readTimeout is the time after which a connection without any data is
+	// considered dead. Meters send a frame every 1 to 10 seconds.
+	readTimeout = time.Minute
+)
+
+var connectedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "gotsmart_source_connected",
+	Help: "whether the p1 data source is currently connected (1) or not (0)",
+})
+
+// source is a P1 data source that can be (re)opened.
+type source interface {
+	Open() (io.ReadCloser, error)
+	String() string
+}
+
+// parseSource returns the source for a URL like tcp://host:port.
+func parseSource(s string) (source, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("missing host in source %q", s)
+		}
+		return tcpSource{addr: u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported source %q", s)
+	}
+}
+
+// serialSource reads P1 data from a local serial device.
+type serialSource struct {
+	config *serial.Config
+}
+
+func (s serialSource) Open() (io.ReadCloser, error) {
+	return serial.OpenPort(s.config)
+}
+
+func (s serialSource) String() string {
+	return s.config.Name
+}
+
+// tcpSource reads the raw telegram stream from a TCP socket as exposed by
+// ser2net or WiFi P1 dongles.
+type tcpSource struct {
+	addr string
+}
+
+func (s tcpSource) Open() (io.ReadCloser, error) {
+	conn, err := net.DialTimeout("tcp", s.addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return deadlineConn{conn}, nil
+}
+
+func (s tcpSource) String() string {
+	return "tcp://" + s.addr
+}
+
+// replaySource reads the telegrams of a recording at speed times the
+// original pace.
+type replaySource struct {
+	path  string
+	speed float64
+}
+
+func (s replaySource) Open() (io.ReadCloser, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{recording.Replay(file, s.speed), file}, nil
+}
+
+func (s replaySource) String() string {
+	return s.path
+}
+
+// deadlineConn fails reads when the remote side stays silent for longer than
+// readTimeout, so half-open connections get noticed.
+type deadlineConn struct {
+	net.Conn
+}
+
+func (c deadlineConn) Read(b []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(readTimeout))
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamBuffer is the number of frames buffered for a stream client.
+	// Clients that fall further behind are dropped.
+	streamBuffer = 16
+	// streamWriteTimeout is the time allowed to write a frame to a client.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// hub fans out frames to the clients of /api/v1/stream as Server-Sent Events
+// or WebSocket messages. Publishing never blocks, clients that can not keep
+// up are dropped instead.
+type hub struct {
+	mutex   sync.Mutex
+	clients map[chan []byte]bool
+
+	// origins are the origins of other sites that may use the stream, *
+	// allows all origins.
+	origins  []string
+	upgrader websocket.Upgrader
+}
+
+func newHub(origins []string) *hub {
+	h := &hub{
+		clients: make(map[chan []byte]bool),
+		origins: origins,
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	return h
+}
+
+// checkOrigin reports if the request is from the same site as the stream or
+// from one of the allowed origins. Requests without Origin header are not
+// made by browsers and always allowed.
+func (h *hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range h.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hub) subscribe() chan []byte {
+	ch := make(chan []byte, streamBuffer)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.clients[ch] = true
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.clients[ch] {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// Publish sends the JSON encoded frame b to all clients.
+func (h *hub) Publish(f dsmr.Frame, b []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- b:
+		default:
+			log.Printf("dropping slow stream client\n")
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+	} else {
+		h.serveEvents(w, r)
+	}
+}
+
+// serveEvents streams frames as Server-Sent Events. The connection is
+// hijacked to set a deadline on every write, so a stalled client can not
+// block forever.
+func (h *hub) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if !h.checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("could not start stream: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	ch := h.subscribe()
+	defer h.unsubscribe(ch)
+
+	// Read to notice closed connections.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		io.Copy(io.Discard, rw)
+	}()
+	write := func(s string) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		_, err := io.WriteString(conn, s)
+		return err
+	}
+	header := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/event-stream\r\n" +
+		"Cache-Control: no-cache\r\n" +
+		"Connection: close\r\n"
+	if origin := r.Header.Get("Origin"); origin != "" {
+		header += "Access-Control-Allow-Origin: " + origin + "\r\n"
+	}
+	if err := write(header + "\r\n"); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case b, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := write(fmt.Sprintf("event: frame\ndata: %s\n\n", b)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveWebSocket streams frames as WebSocket text messages.
+func (h *hub) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already replied with an error.
+		return
+	}
+	defer conn.Close()
+	ch := h.subscribe()
+	defer h.unsubscribe(ch)
+
+	// Read to handle control messages and notice closed connections.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-closed:
+			return
+		case b, ok := <-ch:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"),
+					time.Now().Add(streamWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basvdlei/gotsmart/dsmr"
+	"github.com/gorilla/websocket"
+)
+
+// waitClients waits until n clients are subscribed to h.
+func waitClients(t *testing.T, h *hub, n int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		h.mutex.Lock()
+		got := len(h.clients)
+		h.mutex.Unlock()
+		if got == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d clients", n)
+}
+
+func TestHubPublish(t *testing.T) {
+	h := newHub(nil)
+	fast, slow := h.subscribe(), h.subscribe()
+	for i := 0; i <= streamBuffer; i++ {
+		h.Publish(dsmr.Frame{}, []byte("{}"))
+		<-fast
+	}
+	// The slow client did not read and is dropped once its buffer is full.
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != streamBuffer {
+		t.Errorf("buffered frames do not match %d != %d", n, streamBuffer)
+	}
+	waitClients(t, h, 1)
+	h.unsubscribe(fast)
+	if _, ok := <-fast; ok {
+		t.Error("expected closed channel")
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	h := newHub([]string{"https://dashboard.example.com"})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type does not match %q", ct)
+	}
+	if o := resp.Header.Get("Access-Control-Allow-Origin"); o != "https://dashboard.example.com" {
+		t.Errorf("allowed origin does not match %q", o)
+	}
+	waitClients(t, h, 1)
+	h.Publish(dsmr.Frame{}, []byte(`{"version":"50"}`))
+	br := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if lines[0] != "event: frame" || lines[1] != `data: {"version":"50"}` {
+		t.Errorf("event does not match %q", lines)
+	}
+
+	// Closing the connection unsubscribes the client.
+	resp.Body.Close()
+	waitClients(t, h, 0)
+
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status does not match %d != %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	h := newHub([]string{"https://dashboard.example.com"})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	header := http.Header{"Origin": []string{"https://dashboard.example.com"}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitClients(t, h, 1)
+	h.Publish(dsmr.Frame{}, []byte(`{"version":"50"}`))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, b, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.TextMessage || string(b) != `{"version":"50"}` {
+		t.Errorf("message does not match %d %q", typ, b)
+	}
+
+	// Same site requests are allowed, other sites are not.
+	for origin, allowed := range map[string]bool{
+		srv.URL:                    true,
+		"https://evil.example.com": false,
+	} {
+		header := http.Header{"Origin": []string{origin}}
+		c, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if (err == nil) != allowed {
+			t.Errorf("%s: unexpected result %v", origin, err)
+		}
+		if c != nil {
+			c.Close()
+		}
+	}
+}